@@ -0,0 +1,38 @@
+// Симулятор accrual системы для локальной разработки и тестов GOPHERMART.
+//
+// Запуск: accrual-mock -a localhost:8081 -pipeline REGISTERED,PROCESSING,PROCESSED -rate-limit 60
+//
+// Сценарий ответов по заказу задаётся запросом POST /mock/orders/{number}/script
+// со списком шагов, например [{"code":429,"retry_after":5},{"status":"PROCESSED","accrual":500}]
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+
+	"github.com/closable/go-yandex-loyalty/internal/accrualmock"
+	"github.com/closable/go-yandex-loyalty/internal/handlers"
+)
+
+func main() {
+	address := flag.String("a", "localhost:8081", "Simulator address")
+	pipeline := flag.String("pipeline", strings.Join(accrualmock.DefaultPipeline, ","), "Statuses of registered order, one per request")
+	delay := flag.Duration("delay", 0, "Delay of every order response")
+	rateLimit := flag.Int("rate-limit", 0, "Order requests per minute, 0 means unlimited")
+	flag.Parse()
+
+	logger := handlers.NewLogger()
+	sugar := logger.Sugar()
+
+	mock := accrualmock.New(accrualmock.Options{
+		Pipeline:  strings.Split(*pipeline, ","),
+		Delay:     *delay,
+		RateLimit: *rateLimit,
+	})
+
+	sugar.Infoln("Running accrual simulator on ->", *address)
+	if err := http.ListenAndServe(*address, mock.Handler()); err != nil {
+		sugar.Fatalln(err)
+	}
+}
@@ -2,15 +2,27 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/internal/auth"
 	"github.com/closable/go-yandex-loyalty/internal/backgrounds"
 	"github.com/closable/go-yandex-loyalty/internal/config"
 	"github.com/closable/go-yandex-loyalty/internal/db"
 	"github.com/closable/go-yandex-loyalty/internal/handlers"
+	"github.com/closable/go-yandex-loyalty/internal/lockout"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
+	"github.com/closable/go-yandex-loyalty/internal/migrations"
+	"go.uber.org/zap"
 )
 
 // @title Gophermart loyalty system API
@@ -28,6 +40,9 @@ import (
 // @host 127.0.0.1:8090
 // @BasePath /
 // TODO swag init --output ./docs/ -g ./cmd/gophermart/main.go
+//
+// Миграции схемы СУБД без запуска сервера: gophermart [flags] migrate up|down|status
+// Назначение роли пользователю: gophermart [flags] role <login> user|support|admin
 func main() {
 	if err := run(); err != nil {
 		panic(err)
@@ -39,46 +54,225 @@ func run() error {
 	logger := handlers.NewLogger()
 	sugar := *logger.Sugar()
 
-	//var src handlers.Sourcer
-	var err error
+	if err := cfg.Validate(); err != nil {
+		sugar.Infoln(err)
+		os.Exit(1)
+	}
+
+	// подкоманда управления миграциями: gophermart [flags] migrate up|down|status
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := migrate(cfg.DSN, args[1:]); err != nil {
+			sugar.Infoln(err)
+			os.Exit(1)
+		}
+		return nil
+	}
+	// подкоманда назначения роли: gophermart [flags] role <login> user|support|admin
+	if args := flag.Args(); len(args) > 0 && args[0] == "role" {
+		if err := role(cfg.DSN, args[1:]); err != nil {
+			sugar.Infoln(err)
+			os.Exit(1)
+		}
+		return nil
+	}
+
+	src, err := newStorage(cfg.Storage, cfg.DSN, cfg.QueryTimeout, cfg.PasswordCost, cfg.MigrateOnStart)
+	if err != nil {
+		sugar.Infoln(err)
+		os.Exit(1)
+	}
+
+	acc := accrual.New(cfg.AccrualAddress, cfg.AccrualTimeout, cfg.AccrualMaxConns, &sugar)
+
+	var audience []string
+	if cfg.JWTAudience != "" {
+		audience = strings.Split(cfg.JWTAudience, ",")
+	}
+	tokens, err := newTokens(cfg.JWTSecret, cfg.JWTKeysFile, auth.Config{
+		TTL:        cfg.TokenTTL,
+		RefreshTTL: cfg.RefreshTTL,
+		ActiveKey:  cfg.JWTActiveKey,
+		Issuer:     cfg.JWTIssuer,
+		Audience:   audience,
+	}, &sugar)
+	if err != nil {
+		sugar.Infoln(err)
+		src.Close()
+		os.Exit(1)
+	}
 
-	src, err := db.NewDB(cfg.DSN) // cfg.DSN)
+	// браузеры отклоняют cookie SameSite=None без атрибута Secure
+	sameSite, err := handlers.ParseSameSite(cfg.CookieSameSite)
+	if err == nil && sameSite == http.SameSiteNoneMode && cfg.CookieInsecure {
+		err = errors.New("SameSite=None cookies require Secure attribute")
+	}
 	if err != nil {
 		sugar.Infoln(err)
+		src.Close()
 		os.Exit(1)
 	}
+	cookies := handlers.CookieConfig{
+		Path:     cfg.CookiePath,
+		Domain:   cfg.CookieDomain,
+		Secure:   !cfg.CookieInsecure,
+		SameSite: sameSite,
+	}
+
+	policy := lockout.DefaultPolicy
+	policy.Login.Threshold = cfg.LoginMaxFailures
+	policy.Login.Lockout = cfg.LoginLockout
+	policy.IP.Threshold = cfg.LoginIPMaxFailures
+	policy.IP.Lockout = cfg.LoginLockout
 
-	handler, err := handlers.New(src, sugar, cfg.AccrualAddress)
+	handler, err := handlers.New(src, sugar, acc,
+		handlers.WithTokens(tokens),
+		handlers.WithCookies(cookies),
+		handlers.WithLoginPolicy(policy),
+		handlers.WithTrustProxy(cfg.TrustProxy),
+		handlers.WithPasswordResetTTL(cfg.PasswordResetTTL),
+		handlers.WithShopKeys(strings.Split(cfg.ShopAPIKeys, ",")...),
+		handlers.WithHoldTTL(cfg.HoldTTL),
+	)
 	if err != nil {
 		sugar.Infoln(err)
-		src.DB.Close()
+		src.Close()
 		os.Exit(1)
 	}
 
-	ticker := time.NewTicker(10 * time.Second)
-	done := make(chan bool)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	syncDone := make(chan struct{})
 	go func() {
-		for {
-			select {
-			case <-done:
-				return
-			case t := <-ticker.C:
-				// start sync orders
-				sugar.Infoln("Execute background process sync orders with accruals", t)
-				orders, err := src.NotProcessedOrders()
-				if err != nil {
-					fmt.Println(orders, err)
-				}
-				if len(orders) > 0 {
-					backgrounds.SyncAccruals(src, cfg.AccrualAddress, &sugar, orders...)
-				}
-			}
-		}
+		defer close(syncDone)
+		backgrounds.Run(ctx, src, acc, &sugar, backgrounds.Options{
+			Interval:     cfg.SyncInterval,
+			Batch:        cfg.SyncBatch,
+			Lease:        cfg.SyncLease,
+			Workers:      cfg.SyncWorkers,
+			BatchTimeout: cfg.SyncBatchTimeout,
+		})
 	}()
 
-	sugar.Infoln("Setup DBMS successfuly ->", cfg.DSN)
+	holdsDone := make(chan struct{})
+	go func() {
+		defer close(holdsDone)
+		backgrounds.ExpireHolds(ctx, src, &sugar, cfg.HoldExpiryInterval, holdsBatch)
+	}()
+
+	server := &http.Server{
+		Addr:    cfg.ServerAddress,
+		Handler: handler.InitRouter(),
+	}
+
+	sugar.Infoln("Setup DBMS successfuly ->", cfg.Storage, cfg.DSN)
 	sugar.Infoln("Accrual system address ->", cfg.AccrualAddress)
 	sugar.Infoln("Running server on ->", cfg.ServerAddress)
 
-	return http.ListenAndServe(cfg.ServerAddress, handler.InitRouter())
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		sugar.Infoln("Shutdown signal received, graceful period ->", cfg.ShutdownTimeout)
+	case runErr = <-serverErr:
+		stop()
+	}
+
+	// завершаем обработку запросов, затем ждём сохранения текущего пакета синхронизации
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		sugar.Infoln("Server shutdown", err)
+	}
+
+	finished := true
+	select {
+	case <-syncDone:
+	case <-shutdownCtx.Done():
+		finished = false
+		sugar.Infoln("Background sync did not finish in graceful period")
+	}
+	select {
+	case <-holdsDone:
+	case <-shutdownCtx.Done():
+		finished = false
+		sugar.Infoln("Background holds expiry did not finish in graceful period")
+	}
+
+	if !finished {
+		sugar.Errorln("Closing DBMS while background jobs are still running, orders or holds may be updated partially")
+	}
+	if err := src.Close(); err != nil {
+		sugar.Infoln("Close DBMS", err)
+	}
+	sugar.Infoln("Server stopped")
+
+	return runErr
+}
+
+// Интерфейс системы хранения информации приложения
+type storage interface {
+	handlers.Sourcer
+	backgrounds.Queue
+	backgrounds.HoldExpirer
+	Close() error
+}
+
+// Количество истёкших резервов, снимаемых за один запрос к системе хранения
+const holdsBatch = 500
+
+// Функция создания системы хранения информации по типу: postgres или memory.
+// Миграции схемы СУБД применяются только при migrate, по умолчанию схема
+// подготавливается заранее подкомандой migrate up
+func newStorage(kind, dsn string, timeout time.Duration, passwordCost int, migrate bool) (storage, error) {
+	switch kind {
+	case "memory":
+		return memory.New(memory.WithPasswordCost(passwordCost)), nil
+	case "postgres", "":
+		src, err := db.NewDB(dsn, db.WithQueryTimeout(timeout), db.WithPasswordCost(passwordCost))
+		if err != nil {
+			return nil, err
+		}
+		if migrate {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if _, err = migrations.Up(ctx, src.DB); err != nil {
+				src.Close()
+				return nil, err
+			}
+		}
+		return src, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", kind)
+	}
+}
+
+// Функция создания выпуска токенов: ключи из файла, секрет HS256 или случайный ключ
+func newTokens(secret, keysFile string, tokensCfg auth.Config, sugar *zap.SugaredLogger) (*auth.Tokens, error) {
+	var keys []auth.Key
+	switch {
+	case keysFile != "":
+		var err error
+		if keys, err = auth.LoadKeys(keysFile); err != nil {
+			return nil, err
+		}
+	case secret != "":
+		keys = append(keys, auth.NewHMACKey("default", []byte(secret)))
+	default:
+		key, err := auth.NewRandomKey("random")
+		if err != nil {
+			return nil, err
+		}
+		sugar.Infoln("Token signing key is not set, tokens are signed by random key and expire on restart")
+		keys = append(keys, key)
+	}
+	return auth.NewTokens(tokensCfg, keys...)
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/closable/go-yandex-loyalty/internal/db"
+	"github.com/closable/go-yandex-loyalty/internal/migrations"
+)
+
+// Описание подкоманды управления миграциями
+const migrateUsage = "usage: gophermart [flags] migrate up|down|status"
+
+// Функция выполнения подкоманды migrate up|down|status без запуска сервера
+func migrate(dsn string, args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	src, err := db.NewDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer src.DB.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(ctx, src.DB)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+	case "down":
+		version, err := migrations.Down(ctx, src.DB)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			fmt.Println("no migrations to revert")
+		} else {
+			fmt.Printf("reverted migration %04d\n", version)
+		}
+	case "status":
+		states, err := migrations.Status(ctx, src.DB)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%-30s %s\n", state.Version, state.Name, applied)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/closable/go-yandex-loyalty/internal/db"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Описание подкоманды назначения роли
+const roleUsage = "usage: gophermart [flags] role <login> user|support|admin"
+
+// Функция выполнения подкоманды role: назначение роли пользователю без запуска сервера,
+// позволяет назначить первого администратора
+func role(dsn string, args []string) error {
+	if len(args) != 2 || !models.ValidRole(args[1]) {
+		return errors.New(roleUsage)
+	}
+
+	src, err := db.NewDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer src.DB.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err = src.SetRoleByLogin(ctx, args[0], args[1]); err != nil {
+		return err
+	}
+	// сессии пользователя не отзываются: новая роль действует с очередного обновления токена
+	fmt.Printf("user %s role %s\n", args[0], args[1])
+	return nil
+}
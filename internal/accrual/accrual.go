@@ -0,0 +1,151 @@
+// Пакет клиента системы расчёта начислений accrual
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/models"
+	"go.uber.org/zap"
+)
+
+// Пауза по умолчанию, если accrual вернул 429 без корректного Retry-After
+const DefaultRetryAfter = time.Second * 60
+
+// Структура клиента accrual системы
+type Client struct {
+	address string
+	http    *http.Client
+	sugar   *zap.SugaredLogger
+
+	mu         sync.RWMutex
+	pauseUntil time.Time
+}
+
+// Функция создания клиента accrual системы
+//
+//	address string адрес accrual системы
+//	timeout time.Duration таймаут одного запроса
+//	maxConns int количество переиспользуемых соединений
+func New(address string, timeout time.Duration, maxConns int, sugar *zap.SugaredLogger) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if maxConns > 0 {
+		transport.MaxIdleConns = maxConns
+		transport.MaxIdleConnsPerHost = maxConns
+	}
+
+	return &Client{
+		address: address,
+		http: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		sugar: sugar,
+	}
+}
+
+// Функция возвращает оставшееся время паузы, если accrual ограничил количество запросов
+func (c *Client) Paused() (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	left := time.Until(c.pauseUntil)
+	if left <= 0 {
+		return 0, false
+	}
+	return left, true
+}
+
+// Функция устанавливает паузу обращений к accrual системе
+func (c *Client) pause(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(c.pauseUntil) {
+		c.pauseUntil = until
+	}
+}
+
+// Функция получения информации о расчёте начислений по заказу
+// возвращает результат и HTTP статус ответа accrual системы,
+// во время паузы запрос не выполняется и возвращается статус 429
+func (c *Client) GetOrder(ctx context.Context, orderNumber string) (*models.AccrualGet, int) {
+	accrual := &models.AccrualGet{}
+
+	if left, ok := c.Paused(); ok {
+		c.sugar.Infoln(fmt.Sprintf("accrual client: paused for %s, order %s skipped", left.Round(time.Second), orderNumber))
+		return accrual, http.StatusTooManyRequests
+	}
+
+	c.sugar.Infoln(fmt.Sprintf("getting info from accrual  %s/api/orders/%s", c.address, orderNumber))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/orders/%s", c.address, orderNumber), nil)
+	if err != nil {
+		c.sugar.Infoln("accrual client: getting order info into the system", err)
+		return accrual, http.StatusInternalServerError
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.sugar.Infoln(fmt.Sprintf("accrual client: invalid %v", err))
+		return accrual, http.StatusInternalServerError
+	}
+	defer func() {
+		// дочитываем тело, чтобы соединение вернулось в пул
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retry := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		c.pause(retry)
+		c.sugar.Infoln(fmt.Sprintf("accrual client: too many requests, pause for %s", retry))
+		return accrual, resp.StatusCode
+	}
+
+	if resp.StatusCode > 202 {
+		c.sugar.Infoln(fmt.Sprintf("accrual client: return order %s status %d", orderNumber, resp.StatusCode))
+		return accrual, resp.StatusCode
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.sugar.Infoln("accrual client: read body", err)
+		return accrual, http.StatusInternalServerError
+	}
+
+	if err = json.Unmarshal(body, accrual); err != nil {
+		c.sugar.Infoln("accrual client: unpack body to json", err)
+		return accrual, http.StatusInternalServerError
+	}
+
+	return accrual, resp.StatusCode
+}
+
+// Функция разбора заголовка Retry-After (секунды или HTTP дата)
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return DefaultRetryAfter
+	}
+
+	if sec, err := strconv.Atoi(value); err == nil {
+		if sec < 0 {
+			return DefaultRetryAfter
+		}
+		return time.Duration(sec) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d
+		}
+	}
+
+	return DefaultRetryAfter
+}
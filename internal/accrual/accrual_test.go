@@ -0,0 +1,94 @@
+package accrual
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{
+			name:  "Retry-After seconds",
+			value: "60",
+			want:  time.Second * 60,
+		},
+		{
+			name:  "Retry-After http date",
+			value: now.Add(time.Second * 30).Format(http.TimeFormat),
+			want:  time.Second * 30,
+		},
+		{
+			name:  "Retry-After empty",
+			value: "",
+			want:  DefaultRetryAfter,
+		},
+		{
+			name:  "Retry-After invalid",
+			value: "soon",
+			want:  DefaultRetryAfter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("ParseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_GetOrder(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/api/orders/79927398713":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order": "79927398713", "status": "PROCESSED", "accrual": 500}`))
+		case "/api/orders/1004128237584":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	logger := zap.NewNop()
+	client := New(srv.URL, time.Second, 2, logger.Sugar())
+
+	res, status := client.GetOrder(context.Background(), "79927398713")
+	if status != http.StatusOK || res.Status != "PROCESSED" || res.Order != "79927398713" {
+		t.Errorf("GetOrder() = %v %v, want PROCESSED 200", res, status)
+	}
+
+	if _, status = client.GetOrder(context.Background(), "1004128237584"); status != http.StatusNoContent {
+		t.Errorf("GetOrder() status = %v, want %v", status, http.StatusNoContent)
+	}
+
+	if _, status = client.GetOrder(context.Background(), "12345678903"); status != http.StatusTooManyRequests {
+		t.Errorf("GetOrder() status = %v, want %v", status, http.StatusTooManyRequests)
+	}
+
+	left, ok := client.Paused()
+	if !ok || left <= time.Second*50 {
+		t.Errorf("Paused() = %v %v, want pause about 60s", left, ok)
+	}
+
+	// во время паузы запросы к accrual не выполняются
+	before := calls
+	if _, status = client.GetOrder(context.Background(), "79927398713"); status != http.StatusTooManyRequests || calls != before {
+		t.Errorf("GetOrder() during pause status = %v calls = %d, want 429 without request", status, calls-before)
+	}
+}
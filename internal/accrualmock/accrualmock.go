@@ -0,0 +1,285 @@
+// Пакет симулятора системы расчёта начислений accrual.
+// Реализует GET /api/orders/{number}, регистрацию заказов (POST /api/orders)
+// и механик вознаграждения (POST /api/goods), а также сценарии ответов по заказам:
+// переходы REGISTERED→PROCESSING→PROCESSED, INVALID, 204, 429 с Retry-After,
+// медленные ответы и 500. Используется в тестах и бинарном файле cmd/accrual-mock
+package accrualmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// Переходы статусов зарегистрированного заказа по умолчанию, по одному на запрос
+var DefaultPipeline = []string{"REGISTERED", "PROCESSING", "PROCESSED"}
+
+type (
+	// Параметры симулятора
+	Options struct {
+		// Статусы, которые последовательно возвращаются по зарегистрированному заказу,
+		// последний статус повторяется
+		Pipeline []string
+		// Задержка каждого ответа
+		Delay time.Duration
+		// Допустимое количество запросов информации о заказах в минуту, 0 без ограничений
+		RateLimit int
+	}
+	// Шаг сценария ответа по заказу
+	Step struct {
+		// Статус расчёта
+		Status string `json:"status,omitempty"`
+		// Начисление (для статуса PROCESSED)
+		Accrual models.Money `json:"accrual,omitempty"`
+		// Код ответа вместо результата расчёта: 204, 429, 500
+		Code int `json:"code,omitempty"`
+		// Значение Retry-After в секундах для кода 429
+		RetryAfter int `json:"retry_after,omitempty"`
+		// Задержка ответа в миллисекундах
+		DelayMS int `json:"delay_ms,omitempty"`
+	}
+	// Механика вознаграждения
+	Goods struct {
+		Match      string       `json:"match"`
+		Reward     models.Money `json:"reward"`
+		RewardType string       `json:"reward_type"`
+	}
+	// Товар заказа
+	Item struct {
+		Description string       `json:"description"`
+		Price       models.Money `json:"price"`
+	}
+	// Запрос регистрации заказа
+	Order struct {
+		Order string `json:"order"`
+		Goods []Item `json:"goods"`
+	}
+	// Ответ о расчёте начислений
+	Response struct {
+		Order   string       `json:"order"`
+		Status  string       `json:"status"`
+		Accrual models.Money `json:"accrual,omitempty"`
+	}
+)
+
+// Состояние заказа в симуляторе
+type order struct {
+	accrual  models.Money
+	requests int
+	script   []Step
+}
+
+// Структура симулятора accrual системы
+type Server struct {
+	opts Options
+
+	mu          sync.Mutex
+	goods       map[string]Goods
+	orders      map[string]*order
+	windowStart time.Time
+	windowCount int
+}
+
+// Функция создания симулятора
+func New(opts Options) *Server {
+	if len(opts.Pipeline) == 0 {
+		opts.Pipeline = DefaultPipeline
+	}
+	return &Server{
+		opts:   opts,
+		goods:  make(map[string]Goods),
+		orders: make(map[string]*order),
+	}
+}
+
+// Функция задания сценария ответов по заказу: каждый запрос выполняет
+// следующий шаг, последний шаг повторяется
+func (s *Server) Script(number string, steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[number]
+	if !ok {
+		o = &order{}
+		s.orders[number] = o
+	}
+	o.script = steps
+	o.requests = 0
+}
+
+// Функция получения количества запросов информации о заказе
+func (s *Server) Requests(number string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if o, ok := s.orders[number]; ok {
+		return o.requests
+	}
+	return 0
+}
+
+// Функция получения маршрутов симулятора
+func (s *Server) Handler() http.Handler {
+	router := chi.NewRouter()
+
+	router.Get("/api/orders/{number}", s.getOrder)
+	router.Post("/api/orders", s.registerOrder)
+	router.Post("/api/goods", s.registerGoods)
+	router.Post("/mock/orders/{number}/script", s.scriptOrder)
+
+	return router
+}
+
+// Получение информации о расчёте начислений
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request) {
+	number := chi.URLParam(r, "number")
+
+	step, retryAfter := s.nextStep(number)
+	if s.opts.Delay > 0 {
+		time.Sleep(s.opts.Delay)
+	}
+	if step.DelayMS > 0 {
+		time.Sleep(time.Duration(step.DelayMS) * time.Millisecond)
+	}
+
+	switch step.Code {
+	case 0, http.StatusOK:
+	case http.StatusTooManyRequests:
+		if step.RetryAfter > 0 {
+			retryAfter = step.RetryAfter
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "No more than %d requests per minute allowed", s.opts.RateLimit)
+		return
+	default:
+		w.WriteHeader(step.Code)
+		return
+	}
+
+	resp := Response{Order: number, Status: step.Status}
+	if step.Status == "PROCESSED" {
+		resp.Accrual = step.Accrual
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция выбора ответа на очередной запрос о заказе,
+// возвращает шаг и Retry-After для ограничения частоты запросов
+func (s *Server) nextStep(number string) (Step, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.opts.RateLimit > 0 {
+		now := time.Now()
+		if now.Sub(s.windowStart) >= time.Minute {
+			s.windowStart, s.windowCount = now, 0
+		}
+		s.windowCount++
+		if s.windowCount > s.opts.RateLimit {
+			left := s.windowStart.Add(time.Minute).Sub(now)
+			return Step{Code: http.StatusTooManyRequests}, int(left.Seconds()) + 1
+		}
+	}
+
+	o, ok := s.orders[number]
+	if !ok {
+		return Step{Code: http.StatusNoContent}, 0
+	}
+	o.requests++
+
+	if len(o.script) > 0 {
+		return o.script[min(o.requests, len(o.script))-1], 60
+	}
+
+	status := s.opts.Pipeline[min(o.requests, len(s.opts.Pipeline))-1]
+	return Step{Status: status, Accrual: o.accrual}, 60
+}
+
+// Регистрация нового заказа
+func (s *Server) registerOrder(w http.ResponseWriter, r *http.Request) {
+	req := &Order{}
+	if err := decode(r, req); err != nil || req.Order == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if o, ok := s.orders[req.Order]; ok && len(o.script) == 0 {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	var accrual models.Money
+	for _, item := range req.Goods {
+		for _, g := range s.goods {
+			if !strings.Contains(item.Description, g.Match) {
+				continue
+			}
+			if g.RewardType == "%" {
+				accrual += item.Price * g.Reward / 10000
+			} else {
+				accrual += g.Reward
+			}
+		}
+	}
+
+	o, ok := s.orders[req.Order]
+	if !ok {
+		o = &order{}
+		s.orders[req.Order] = o
+	}
+	o.accrual = accrual
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Регистрация механики вознаграждения
+func (s *Server) registerGoods(w http.ResponseWriter, r *http.Request) {
+	req := &Goods{}
+	if err := decode(r, req); err != nil || req.Match == "" || (req.RewardType != "%" && req.RewardType != "pt") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.goods[req.Match]; ok {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	s.goods[req.Match] = *req
+	w.WriteHeader(http.StatusOK)
+}
+
+// Задание сценария ответов по заказу через HTTP
+func (s *Server) scriptOrder(w http.ResponseWriter, r *http.Request) {
+	steps := make([]Step, 0)
+	if err := decode(r, &steps); err != nil || len(steps) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.Script(chi.URLParam(r, "number"), steps...)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Функция чтения JSON тела запроса
+func decode(r *http.Request, v any) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
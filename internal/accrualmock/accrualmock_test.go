@@ -0,0 +1,113 @@
+package accrualmock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/models"
+	"go.uber.org/zap"
+)
+
+// Функция регистрации данных в симуляторе через HTTP
+func post(t *testing.T, url, body string, want int) {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s error = %v", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != want {
+		t.Fatalf("POST %s status = %d, want %d", url, resp.StatusCode, want)
+	}
+}
+
+func TestServer_Pipeline(t *testing.T) {
+	srv := httptest.NewServer(New(Options{}).Handler())
+	defer srv.Close()
+	acc := accrual.New(srv.URL, time.Second, 1, zap.NewNop().Sugar())
+
+	post(t, srv.URL+"/api/goods", `{"match": "Bork", "reward": 10, "reward_type": "%"}`, http.StatusOK)
+	post(t, srv.URL+"/api/goods", `{"match": "Bork", "reward": 5, "reward_type": "pt"}`, http.StatusConflict)
+	post(t, srv.URL+"/api/goods", `{"match": "Tefal", "reward": 5.5, "reward_type": "pt"}`, http.StatusOK)
+	post(t, srv.URL+"/api/orders", `{"order": "79927398713", "goods": [
+		{"description": "Чайник Bork", "price": 7000},
+		{"description": "Сковорода Tefal", "price": 1000}]}`, http.StatusAccepted)
+	post(t, srv.URL+"/api/orders", `{"order": "79927398713"}`, http.StatusConflict)
+
+	for _, want := range DefaultPipeline {
+		res, code := acc.GetOrder(context.Background(), "79927398713")
+		if code != http.StatusOK || res.Status != want {
+			t.Fatalf("GetOrder() = %v, %d, want %s", res, code, want)
+		}
+		if want == "PROCESSED" && res.Accrual != models.Money(70550) {
+			t.Errorf("GetOrder() accrual = %s, want 705.5", res.Accrual)
+		}
+	}
+
+	if _, code := acc.GetOrder(context.Background(), "1004128237584"); code != http.StatusNoContent {
+		t.Errorf("GetOrder() unknown order status = %d, want %d", code, http.StatusNoContent)
+	}
+}
+
+func TestServer_Script(t *testing.T) {
+	mock := New(Options{})
+	srv := httptest.NewServer(mock.Handler())
+	defer srv.Close()
+	acc := accrual.New(srv.URL, time.Millisecond*100, 1, zap.NewNop().Sugar())
+
+	mock.Script("79927398713",
+		Step{Code: http.StatusInternalServerError},
+		Step{Code: http.StatusOK, Status: "PROCESSING", DelayMS: 500},
+		Step{Status: "INVALID"})
+
+	if _, code := acc.GetOrder(context.Background(), "79927398713"); code != http.StatusInternalServerError {
+		t.Errorf("GetOrder() status = %d, want %d", code, http.StatusInternalServerError)
+	}
+	// ответ медленнее таймаута клиента
+	if _, code := acc.GetOrder(context.Background(), "79927398713"); code < http.StatusInternalServerError {
+		t.Errorf("GetOrder() slow response status = %d, want error", code)
+	}
+	if res, code := acc.GetOrder(context.Background(), "79927398713"); code != http.StatusOK || res.Status != "INVALID" {
+		t.Errorf("GetOrder() = %v, %d, want INVALID", res, code)
+	}
+	if got := mock.Requests("79927398713"); got != 3 {
+		t.Errorf("Requests() = %d, want 3", got)
+	}
+
+	post(t, srv.URL+"/mock/orders/1004128237584/script", `[{"code": 429, "retry_after": 7}]`, http.StatusOK)
+	if _, code := acc.GetOrder(context.Background(), "1004128237584"); code != http.StatusTooManyRequests {
+		t.Errorf("GetOrder() status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if left, ok := acc.Paused(); !ok || left <= time.Second*6 || left > time.Second*7 {
+		t.Errorf("Paused() = %v, %v, want about 7s", left, ok)
+	}
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	srv := httptest.NewServer(New(Options{RateLimit: 2}).Handler())
+	defer srv.Close()
+
+	codes := make([]int, 0)
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(srv.URL + "/api/orders/79927398713")
+		if err != nil {
+			t.Fatalf("GET error = %v", err)
+		}
+		resp.Body.Close()
+		codes = append(codes, resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+			t.Errorf("Retry-After header is missing")
+		}
+	}
+	want := []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("status codes = %v, want %v", codes, want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Пакет выпуска и проверки JWT токенов пользователей.
+// Токены подписываются активным ключом, идентификатор которого передаётся в заголовке kid,
+// проверка выполняется любым из настроенных ключей. Поддерживаются HS256, RS256 и EdDSA,
+// открытые ключи асимметричных алгоритмов публикуются в формате JWKS,
+// что позволяет другим сервисам проверять токены без доступа к секрету
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Время жизни токенов по умолчанию
+const (
+	// Токен доступа
+	DefaultTTL = time.Minute * 15
+	// Refresh токен сессии
+	DefaultRefreshTTL = time.Hour * 24 * 30
+)
+
+// Ошибки выпуска и проверки токенов, текст ошибки проверки сообщается клиенту
+var (
+	ErrorNoKeys           = errors.New("no signing keys")
+	ErrorUnknownKey       = errors.New("unknown signing key")
+	ErrorTokenMissing     = errors.New("token is missing")
+	ErrorTokenMalformed   = errors.New("token is malformed")
+	ErrorTokenSignature   = errors.New("token signature is invalid")
+	ErrorTokenAlgorithm   = errors.New("token signing algorithm is not allowed")
+	ErrorTokenExpired     = errors.New("token is expired")
+	ErrorTokenNotValidYet = errors.New("token is not valid yet")
+	ErrorTokenIssuer      = errors.New("token issuer is invalid")
+	ErrorTokenAudience    = errors.New("token audience is invalid")
+	ErrorSessionRevoked   = errors.New("session is revoked")
+)
+
+// Параметры выпуска токенов
+type Config struct {
+	// Время жизни токена доступа, по умолчанию DefaultTTL
+	TTL time.Duration
+	// Время жизни refresh токена сессии, по умолчанию DefaultRefreshTTL
+	RefreshTTL time.Duration
+	// Идентификатор ключа подписи, по умолчанию первый ключ списка
+	ActiveKey string
+	// Издатель токенов (iss), проверяется, если задан
+	Issuer string
+	// Получатели токенов (aud), выпускаемый токен адресован всем,
+	// при проверке требуется совпадение с первым получателем
+	Audience []string
+}
+
+// Структура описания JWT токена
+type Claims struct {
+	jwt.RegisteredClaims
+	UserID int
+	// Идентификатор сессии, в рамках которой выпущен токен
+	SessionID string `json:"sid,omitempty"`
+	// Роли пользователя
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Структура выпуска и проверки токенов
+type Tokens struct {
+	keys   map[string]Key
+	order  []string
+	active Key
+	cfg    Config
+	now    func() time.Time
+}
+
+// Функция создания выпуска токенов. Токены подписываются ключом cfg.ActiveKey,
+// остальные ключи используются только для проверки
+func NewTokens(cfg Config, keys ...Key) (*Tokens, error) {
+	if len(keys) == 0 {
+		return nil, ErrorNoKeys
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = DefaultRefreshTTL
+	}
+	activeID := cfg.ActiveKey
+	if activeID == "" {
+		activeID = keys[0].ID
+	}
+
+	t := &Tokens{
+		keys: make(map[string]Key, len(keys)),
+		cfg:  cfg,
+		now:  time.Now,
+	}
+	for _, key := range keys {
+		if _, ok := t.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key %s", key.ID)
+		}
+		t.keys[key.ID] = key
+		t.order = append(t.order, key.ID)
+	}
+
+	active, ok := t.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %s: %w", activeID, ErrorUnknownKey)
+	}
+	if !active.CanSign() {
+		return nil, fmt.Errorf("active key %s can only verify tokens", activeID)
+	}
+	t.active = active
+
+	return t, nil
+}
+
+// Время жизни выпускаемых токенов доступа
+func (t *Tokens) TTL() time.Duration {
+	return t.cfg.TTL
+}
+
+// Время жизни refresh токенов сессий
+func (t *Tokens) RefreshTTL() time.Duration {
+	return t.cfg.RefreshTTL
+}
+
+// Функция выпуска токена доступа пользователя с его ролями в рамках сессии
+func (t *Tokens) Build(userID int, sessionID string, roles ...string) (string, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := t.now()
+	token := jwt.NewWithClaims(t.active.Method, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.cfg.Issuer,
+			Subject:   strconv.Itoa(userID),
+			Audience:  t.cfg.Audience,
+			ID:        id,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.cfg.TTL)),
+		},
+		UserID:    userID,
+		SessionID: sessionID,
+		Roles:     roles,
+	})
+	token.Header["kid"] = t.active.ID
+
+	return token.SignedString(t.active.sign)
+}
+
+// Функция генерации случайного идентификатора токена (jti)
+func newTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Функция проверки токена и получения его утверждений.
+// Ключ выбирается по заголовку kid, токены без kid проверяются активным ключом.
+// Алгоритм подписи должен совпадать с алгоритмом ключа, срок действия обязателен,
+// издатель и получатель проверяются, если заданы в Config
+func (t *Tokens) Parse(tokenString string) (*Claims, error) {
+	if tokenString == "" {
+		return nil, ErrorTokenMissing
+	}
+
+	claims := &Claims{}
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		key := t.active
+		if kid, ok := token.Header["kid"].(string); ok {
+			if key, ok = t.keys[kid]; !ok {
+				return nil, fmt.Errorf("%w %s", ErrorUnknownKey, kid)
+			}
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("%w: %s", ErrorTokenAlgorithm, token.Method.Alg())
+		}
+		return key.verify, nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrorUnknownKey), errors.Is(err, ErrorTokenAlgorithm):
+		return nil, err
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return nil, ErrorTokenSignature
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrorTokenMalformed, err.Error())
+	}
+
+	if err = t.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Функция проверки утверждений токена
+func (t *Tokens) validate(claims *Claims) error {
+	now := t.now()
+	if !claims.VerifyExpiresAt(now, true) {
+		return ErrorTokenExpired
+	}
+	if !claims.VerifyNotBefore(now, false) || !claims.VerifyIssuedAt(now, false) {
+		return ErrorTokenNotValidYet
+	}
+	if t.cfg.Issuer != "" && !claims.VerifyIssuer(t.cfg.Issuer, true) {
+		return ErrorTokenIssuer
+	}
+	if len(t.cfg.Audience) > 0 && !claims.VerifyAudience(t.cfg.Audience[0], true) {
+		return ErrorTokenAudience
+	}
+	if claims.UserID == 0 {
+		return fmt.Errorf("%w: user is missing", ErrorTokenMalformed)
+	}
+	if claims.SessionID == "" {
+		return fmt.Errorf("%w: session is missing", ErrorTokenMalformed)
+	}
+	return nil
+}
+
+// Функция получения открытых ключей асимметричных алгоритмов
+func (t *Tokens) JWKS() JWKS {
+	res := JWKS{Keys: make([]JWK, 0)}
+	for _, id := range t.order {
+		if jwk, ok := t.keys[id].JWK(); ok {
+			res.Keys = append(res.Keys, jwk)
+		}
+	}
+	return res
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Функция записи файла во временный каталог теста
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Функция записи ключа в PEM файл
+func writePEM(t *testing.T, dir, name, kind string, der []byte) string {
+	t.Helper()
+	return writeFile(t, dir, name, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}))
+}
+
+func TestTokens_Rotation(t *testing.T) {
+	old := NewHMACKey("2024-01", []byte("old secret"))
+	current := NewHMACKey("2024-04", []byte("new secret"))
+
+	before, _ := NewTokens(Config{TTL: time.Hour}, old)
+	token, err := before.Build(4, "session")
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	// новый ключ подписи, старый остаётся для проверки выпущенных токенов
+	after, err := NewTokens(Config{TTL: time.Hour, ActiveKey: current.ID}, old, current)
+	if err != nil {
+		t.Fatalf("NewTokens() error = %v", err)
+	}
+	claims, err := after.Parse(token)
+	if err != nil || claims.UserID != 4 {
+		t.Fatalf("Parse() old token = %v, %v, want user 4", claims, err)
+	}
+
+	fresh, _ := after.Build(5, "session")
+	parsed, _ := jwt.Parse(fresh, nil)
+	if parsed.Header["kid"] != current.ID {
+		t.Errorf("Build() kid = %v, want %s", parsed.Header["kid"], current.ID)
+	}
+
+	// после удаления старого ключа его токены не принимаются
+	removed, _ := NewTokens(Config{TTL: time.Hour}, current)
+	if _, err = removed.Parse(token); !errors.Is(err, ErrorUnknownKey) {
+		t.Errorf("Parse() removed key error = %v, want %v", err, ErrorUnknownKey)
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaPublic, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edPrivate, _ := x509.MarshalPKCS8PrivateKey(edKey)
+
+	configs := []KeyConfig{
+		{ID: "ed", Algorithm: "EdDSA", PrivateKeyFile: writePEM(t, dir, "ed.pem", "PRIVATE KEY", edPrivate)},
+		{ID: "rsa", Algorithm: "RS256", PrivateKeyFile: writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))},
+		{ID: "hs", Algorithm: "HS256", SecretFile: writeFile(t, dir, "secret", []byte("secret\n"))},
+	}
+	data, _ := json.Marshal(configs)
+	keys, err := LoadKeys(writeFile(t, dir, "keys.json", data))
+	if err != nil {
+		t.Fatalf("LoadKeys() error = %v", err)
+	}
+
+	for _, active := range []string{"ed", "rsa", "hs"} {
+		tokens, err := NewTokens(Config{TTL: time.Hour, ActiveKey: active}, keys...)
+		if err != nil {
+			t.Fatalf("NewTokens() error = %v", err)
+		}
+		token, _ := tokens.Build(7, "session")
+		if claims, err := tokens.Parse(token); err != nil || claims.UserID != 7 {
+			t.Errorf("Parse() %s token = %v, %v, want user 7", active, claims, err)
+		}
+	}
+
+	// сторонний сервис проверяет токены только открытым ключом
+	signer, _ := NewTokens(Config{TTL: time.Hour, ActiveKey: "rsa"}, keys...)
+	token, _ := signer.Build(8, "session")
+	public, err := LoadKey(KeyConfig{ID: "rsa", Algorithm: "RS256", PublicKeyFile: writePEM(t, dir, "rsa.pub", "PUBLIC KEY", rsaPublic)})
+	if err != nil {
+		t.Fatalf("LoadKey() error = %v", err)
+	}
+	if _, err = NewTokens(Config{TTL: time.Hour}, public); err == nil {
+		t.Errorf("NewTokens() with verify only key, want error")
+	}
+	verifier := &Tokens{keys: map[string]Key{"rsa": public}, active: public, now: time.Now}
+	if claims, err := verifier.Parse(token); err != nil || claims.UserID != 8 {
+		t.Errorf("Parse() with public key = %v, %v, want user 8", claims, err)
+	}
+
+	jwks := signer.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].KeyType != "OKP" || jwks.Keys[1].KeyType != "RSA" || jwks.Keys[1].E != "AQAB" {
+		t.Errorf("JWKS() = %+v, want ed and rsa public keys", jwks)
+	}
+
+	if _, err = LoadKey(KeyConfig{ID: "none", Algorithm: "none"}); !errors.Is(err, ErrorKeyAlgorithm) {
+		t.Errorf("LoadKey() error = %v, want %v", err, ErrorKeyAlgorithm)
+	}
+}
+
+func TestTokens_AlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	tokens, _ := NewTokens(Config{TTL: time.Hour}, NewRSAKey("rsa", rsaKey))
+
+	// токен HS256, подписанный открытым ключом RSA, с kid ключа RS256
+	public := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		UserID:           1,
+	})
+	forged.Header["kid"] = "rsa"
+	token, _ := forged.SignedString(public)
+
+	if _, err := tokens.Parse(token); !errors.Is(err, ErrorTokenAlgorithm) {
+		t.Errorf("Parse() forged token error = %v, want %v", err, ErrorTokenAlgorithm)
+	}
+}
+
+func TestTokens_Validation(t *testing.T) {
+	key := NewHMACKey("hs", []byte("secret"))
+	cfg := Config{TTL: time.Hour, Issuer: "gophermart", Audience: []string{"gophermart"}}
+	tokens, _ := NewTokens(cfg, key)
+	valid, _ := tokens.Build(4, "session")
+
+	// токен, выпущенный в прошлом и истёкший
+	expired := &Tokens{keys: tokens.keys, active: key, cfg: cfg, now: func() time.Time { return time.Now().Add(-time.Hour * 2) }}
+	expiredToken, _ := expired.Build(4, "session")
+
+	other, _ := NewTokens(Config{TTL: time.Hour, Issuer: "other", Audience: []string{"gophermart"}}, key)
+	otherIssuer, _ := other.Build(4, "session")
+	other, _ = NewTokens(Config{TTL: time.Hour, Issuer: "gophermart", Audience: []string{"shop"}}, key)
+	otherAudience, _ := other.Build(4, "session")
+	other, _ = NewTokens(cfg, NewHMACKey("hs", []byte("other secret")))
+	badSignature, _ := other.Build(4, "session")
+
+	noExp := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: 4, SessionID: "session"})
+	noExp.Header["kid"] = "hs"
+	noExpToken, _ := noExp.SignedString([]byte("secret"))
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{name: "valid", token: valid},
+		{name: "missing", token: "", err: ErrorTokenMissing},
+		{name: "malformed", token: "not.a.token", err: ErrorTokenMalformed},
+		{name: "expired", token: expiredToken, err: ErrorTokenExpired},
+		{name: "without exp", token: noExpToken, err: ErrorTokenExpired},
+		{name: "wrong issuer", token: otherIssuer, err: ErrorTokenIssuer},
+		{name: "wrong audience", token: otherAudience, err: ErrorTokenAudience},
+		{name: "bad signature", token: badSignature, err: ErrorTokenSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tokens.Parse(tt.token)
+			if !errors.Is(err, tt.err) || (err == nil && claims.UserID != 4) {
+				t.Errorf("Parse() = %v, %v, want %v", claims, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	token, hash, err := NewRefreshToken("session")
+	if err != nil {
+		t.Fatalf("NewRefreshToken() error = %v", err)
+	}
+	other, otherHash, _ := NewRefreshToken("session")
+	if token == other || hash == otherHash {
+		t.Errorf("NewRefreshToken() returned same token twice")
+	}
+
+	sessionID, parsedHash, err := ParseRefreshToken(token)
+	if err != nil || sessionID != "session" || parsedHash != hash {
+		t.Errorf("ParseRefreshToken() = %s, %s, %v, want session, %s", sessionID, parsedHash, err, hash)
+	}
+	for _, bad := range []string{"", "session", ".secret", "session."} {
+		if _, _, err = ParseRefreshToken(bad); !errors.Is(err, ErrorRefreshMalformed) {
+			t.Errorf("ParseRefreshToken(%q) error = %v, want %v", bad, err, ErrorRefreshMalformed)
+		}
+	}
+}
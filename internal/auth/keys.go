@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Ошибки описания ключей
+var (
+	ErrorKeyAlgorithm = errors.New("unsupported signing algorithm")
+	ErrorKeyMaterial  = errors.New("key material is not set")
+)
+
+type (
+	// Описание ключа подписи в файле ключей
+	KeyConfig struct {
+		// Идентификатор ключа, передаётся в заголовке kid токена
+		ID string `json:"kid"`
+		// Алгоритм подписи: HS256, RS256 или EdDSA
+		Algorithm string `json:"alg"`
+		// Секрет HS256
+		Secret string `json:"secret,omitempty"`
+		// Файл с секретом HS256
+		SecretFile string `json:"secret_file,omitempty"`
+		// PEM файл закрытого ключа RS256/EdDSA
+		PrivateKeyFile string `json:"private_key_file,omitempty"`
+		// PEM файл открытого ключа RS256/EdDSA, для ключей, которые только проверяют подпись
+		PublicKeyFile string `json:"public_key_file,omitempty"`
+	}
+	// Ключ подписи токенов
+	Key struct {
+		// Идентификатор ключа
+		ID string
+		// Алгоритм подписи
+		Method jwt.SigningMethod
+		// Ключ подписи, nil для ключей, которые только проверяют подпись
+		sign any
+		// Ключ проверки подписи
+		verify any
+	}
+)
+
+// Функция создания ключа HS256
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+}
+
+// Функция создания ключа RS256
+func NewRSAKey(id string, private *rsa.PrivateKey) Key {
+	return Key{ID: id, Method: jwt.SigningMethodRS256, sign: private, verify: &private.PublicKey}
+}
+
+// Функция создания ключа EdDSA
+func NewEdDSAKey(id string, private ed25519.PrivateKey) Key {
+	return Key{ID: id, Method: jwt.SigningMethodEdDSA, sign: private, verify: private.Public()}
+}
+
+// Функция создания случайного ключа HS256, токены которого теряют силу при перезапуске
+func NewRandomKey(id string) (Key, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+	return NewHMACKey(id, secret), nil
+}
+
+// Признак наличия у ключа секрета для подписи
+func (k Key) CanSign() bool {
+	return k.sign != nil
+}
+
+// Функция загрузки ключа по его описанию
+func LoadKey(cfg KeyConfig) (Key, error) {
+	if cfg.ID == "" {
+		return Key{}, fmt.Errorf("key without kid: %w", ErrorKeyMaterial)
+	}
+
+	switch cfg.Algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		secret := []byte(cfg.Secret)
+		if cfg.SecretFile != "" {
+			data, err := os.ReadFile(cfg.SecretFile)
+			if err != nil {
+				return Key{}, fmt.Errorf("key %s: %w", cfg.ID, err)
+			}
+			secret = []byte(strings.TrimSpace(string(data)))
+		}
+		if len(secret) == 0 {
+			return Key{}, fmt.Errorf("key %s: %w", cfg.ID, ErrorKeyMaterial)
+		}
+		return NewHMACKey(cfg.ID, secret), nil
+
+	case jwt.SigningMethodRS256.Alg():
+		return loadAsymmetric(cfg, jwt.SigningMethodRS256,
+			func(data []byte) (any, error) { return jwt.ParseRSAPrivateKeyFromPEM(data) },
+			func(data []byte) (any, error) { return jwt.ParseRSAPublicKeyFromPEM(data) },
+			func(private any) any { return &private.(*rsa.PrivateKey).PublicKey })
+
+	case jwt.SigningMethodEdDSA.Alg():
+		return loadAsymmetric(cfg, jwt.SigningMethodEdDSA,
+			func(data []byte) (any, error) { return jwt.ParseEdPrivateKeyFromPEM(data) },
+			func(data []byte) (any, error) { return jwt.ParseEdPublicKeyFromPEM(data) },
+			func(private any) any { return private.(ed25519.PrivateKey).Public() })
+	}
+
+	return Key{}, fmt.Errorf("key %s %q: %w", cfg.ID, cfg.Algorithm, ErrorKeyAlgorithm)
+}
+
+// Функция загрузки асимметричного ключа из PEM файлов
+func loadAsymmetric(cfg KeyConfig, method jwt.SigningMethod,
+	parsePrivate, parsePublic func([]byte) (any, error), public func(any) any) (Key, error) {
+	key := Key{ID: cfg.ID, Method: method}
+
+	switch {
+	case cfg.PrivateKeyFile != "":
+		data, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return Key{}, fmt.Errorf("key %s: %w", cfg.ID, err)
+		}
+		if key.sign, err = parsePrivate(data); err != nil {
+			return Key{}, fmt.Errorf("key %s: %w", cfg.ID, err)
+		}
+		key.verify = public(key.sign)
+	case cfg.PublicKeyFile != "":
+		data, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return Key{}, fmt.Errorf("key %s: %w", cfg.ID, err)
+		}
+		if key.verify, err = parsePublic(data); err != nil {
+			return Key{}, fmt.Errorf("key %s: %w", cfg.ID, err)
+		}
+	default:
+		return Key{}, fmt.Errorf("key %s: %w", cfg.ID, ErrorKeyMaterial)
+	}
+	return key, nil
+}
+
+// Функция загрузки ключей из JSON файла со списком описаний KeyConfig
+func LoadKeys(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]KeyConfig, 0)
+	if err = json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("keys file %s: %w", path, err)
+	}
+
+	keys := make([]Key, 0, len(configs))
+	for _, cfg := range configs {
+		key, err := LoadKey(cfg)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+type (
+	// Открытый ключ в формате JWK (RFC 7517)
+	JWK struct {
+		KeyType   string `json:"kty"`
+		ID        string `json:"kid"`
+		Algorithm string `json:"alg"`
+		Use       string `json:"use"`
+		N         string `json:"n,omitempty"`
+		E         string `json:"e,omitempty"`
+		Curve     string `json:"crv,omitempty"`
+		X         string `json:"x,omitempty"`
+	}
+	// Набор открытых ключей
+	JWKS struct {
+		Keys []JWK `json:"keys"`
+	}
+)
+
+// Функция получения открытого ключа в формате JWK, для ключей HS256 возвращает false
+func (k Key) JWK() (JWK, bool) {
+	res := JWK{ID: k.ID, Algorithm: k.Method.Alg(), Use: "sig"}
+
+	switch public := k.verify.(type) {
+	case *rsa.PublicKey:
+		res.KeyType = "RSA"
+		res.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		res.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		res.KeyType = "OKP"
+		res.Curve = "Ed25519"
+		res.X = base64.RawURLEncoding.EncodeToString(public)
+	default:
+		return JWK{}, false
+	}
+	return res, true
+}
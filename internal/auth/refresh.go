@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Ошибка, refresh токен не соответствует формату
+var ErrorRefreshMalformed = errors.New("refresh token is malformed")
+
+// Функция создания идентификатора сессии
+func NewSessionID() (string, error) {
+	return newTokenID()
+}
+
+// Функция выпуска refresh токена сессии вида <session>.<secret>,
+// возвращает токен и хэш секрета, который хранится на сервере
+func NewRefreshToken(sessionID string) (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return sessionID + "." + encoded, hashSecret(encoded), nil
+}
+
+// Функция разбора refresh токена на идентификатор сессии и хэш секрета
+func ParseRefreshToken(token string) (string, string, error) {
+	sessionID, secret, ok := strings.Cut(token, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return "", "", ErrorRefreshMalformed
+	}
+	return sessionID, hashSecret(secret), nil
+}
+
+// Функция выпуска одноразового токена сброса пароля,
+// возвращает токен и его хэш, который хранится на сервере
+func NewResetToken() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashSecret(token), nil
+}
+
+// Функция хэширования токена сброса пароля
+func HashResetToken(token string) string {
+	return hashSecret(token)
+}
+
+// Функция хэширования секрета refresh токена
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
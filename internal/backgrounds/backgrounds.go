@@ -2,39 +2,167 @@
 package backgrounds
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"sync"
+	"time"
 
-	"github.com/closable/go-yandex-loyalty/internal/db"
-	"github.com/closable/go-yandex-loyalty/internal/handlers"
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/models"
 	"go.uber.org/zap"
 )
 
+// Интерфейс очереди заказов для синхронизации с accrual системой
+type Queue interface {
+	// Захват (аренда) необработанных заказов
+	LeaseOrders(ctx context.Context, limit int, lease time.Duration) ([]string, error)
+	// Перенос заказа на повторную обработку с задержкой
+	RetryOrder(ctx context.Context, order string) error
+	// Возврат захваченных заказов в очередь без учёта попытки
+	ReleaseOrders(ctx context.Context, delay time.Duration, orders ...string) error
+	// Обновление состояния заказа по данным accrual системы
+	UpdateNotProcessedOrders(ctx context.Context, order, status string, accrual models.Money) error
+}
+
 // Функция предназначена для минхронизации состояния заказов между приложением и системой accruals
 //
 //	паметрами являются
-//	db *db.Store указатель на активную систему хранения информации
-//	acc string строка подключения к accrual системе
-//	orders ...string  список необработанных заказов
-func SyncAccruals(db *db.Store, acc string, sugar *zap.SugaredLogger, orders ...string) {
-	var wg sync.WaitGroup
+//	ctx context.Context контекст пакета, ограничивающий время синхронизации
+//	queue Queue очередь заказов активной системы хранения информации
+//	acc *accrual.Client клиент accrual системы
+//	workers int количество одновременно обрабатываемых заказов
+//	orders ...string  список заказов, захваченных из очереди
+//
+// Обработка пакета прекращается при отмене контекста или когда accrual
+// ограничивает количество запросов, необработанные заказы возвращаются в очередь
+func SyncAccruals(ctx context.Context, queue Queue, acc *accrual.Client, sugar *zap.SugaredLogger, workers int, orders ...string) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		skipped = make([]string, 0)
+	)
+	skip := func(orders ...string) {
+		mu.Lock()
+		skipped = append(skipped, orders...)
+		mu.Unlock()
+	}
 
-	for _, order := range orders {
+	jobs := make(chan string)
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func() {
-
 			defer wg.Done()
-			res, status := handlers.AccrualActions(order, sugar, acc)
-			if status < 204 {
-				err := db.UpdateNotProcessedOrders(res.Order, res.Status, res.Accrual)
-				if err != nil {
-					sugar.Infoln(fmt.Sprintf("background sync order %s operation failed %s", order, err))
+			for order := range jobs {
+				if ok := syncOrder(ctx, queue, acc, sugar, order); !ok {
+					// accrual ограничил запросы или пакет прерван, останавливаем всех
+					skip(order)
+					cancel()
 				}
-				sugar.Infoln("background sync order complete", order)
 			}
 		}()
-		wg.Wait()
+	}
+
+feed:
+	for i, order := range orders {
+		if left, ok := acc.Paused(); ok {
+			sugar.Infoln(fmt.Sprintf("background sync paused for %s", left.Round(time.Second)))
+			cancel()
+		}
+		select {
+		case <-ctx.Done():
+			skip(orders[i:]...)
+			break feed
+		case jobs <- order:
+		}
+	}
+	close(jobs)
+	wg.Wait()
 
+	if len(skipped) > 0 {
+		left, _ := acc.Paused()
+		if err := queue.ReleaseOrders(context.WithoutCancel(ctx), left, skipped...); err != nil {
+			sugar.Infoln(fmt.Sprintf("background sync release orders failed %s", err))
+		}
+		sugar.Infoln(fmt.Sprintf("background sync returned to queue %d orders", len(skipped)))
 	}
+}
 
+// Функция синхронизации одного заказа, возвращает false, если заказ
+// не обработан из-за ограничения accrual или отмены контекста.
+// Полученный ответ сохраняется, даже если пакет уже прерван другим обработчиком
+func syncOrder(ctx context.Context, queue Queue, acc *accrual.Client, sugar *zap.SugaredLogger, order string) bool {
+	res, status := acc.GetOrder(ctx, order)
+	if status == http.StatusTooManyRequests {
+		return false
+	}
+
+	// изменения сохраняются без отмены, как и возврат заказов в ReleaseOrders
+	storeCtx := context.WithoutCancel(ctx)
+	if status < 204 {
+		err := queue.UpdateNotProcessedOrders(storeCtx, res.Order, res.Status, res.Accrual)
+		if err == nil {
+			sugar.Infoln("background sync order complete", order)
+			return true
+		}
+		sugar.Infoln(fmt.Sprintf("background sync order %s operation failed %s", order, err))
+	} else if ctx.Err() != nil {
+		// запрос прерван вместе с пакетом, заказ возвращается в очередь без учёта попытки
+		return false
+	}
+
+	if err := queue.RetryOrder(storeCtx, order); err != nil {
+		sugar.Infoln(fmt.Sprintf("background sync order %s retry failed %s", order, err))
+	}
+	return true
+}
+
+// Параметры цикла фоновой синхронизации
+type Options struct {
+	// Интервал опроса очереди
+	Interval time.Duration
+	// Количество заказов, захватываемых за один опрос
+	Batch int
+	// Время аренды захваченных заказов
+	Lease time.Duration
+	// Количество одновременно обрабатываемых заказов
+	Workers int
+	// Максимальное время обработки пакета
+	BatchTimeout time.Duration
+}
+
+// Функция цикла синхронизации заказов с accrual системой, работает до отмены ctx.
+// Отмена ctx не прерывает текущий пакет: функция возвращается только после
+// того, как изменения пакета сохранены (или истёк BatchTimeout)
+func Run(ctx context.Context, queue Queue, acc *accrual.Client, sugar *zap.SugaredLogger, opts Options) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			sugar.Infoln("background sync stopped")
+			return
+		case t := <-ticker.C:
+			// start sync orders
+			sugar.Infoln("Execute background process sync orders with accruals", t)
+			orders, err := queue.LeaseOrders(ctx, opts.Batch, opts.Lease)
+			if err != nil {
+				sugar.Infoln(fmt.Sprintf("background sync lease orders failed %s", err))
+				continue
+			}
+			if len(orders) > 0 {
+				batchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), opts.BatchTimeout)
+				SyncAccruals(batchCtx, queue, acc, sugar, opts.Workers, orders...)
+				cancel()
+			}
+		}
+	}
 }
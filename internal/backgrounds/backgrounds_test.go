@@ -0,0 +1,201 @@
+package backgrounds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/internal/accrualmock"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
+	"github.com/closable/go-yandex-loyalty/internal/utils"
+	"github.com/closable/go-yandex-loyalty/models"
+	"go.uber.org/zap"
+)
+
+// Функция подготовки пользователя с необработанными заказами
+func prepare(t *testing.T, src *memory.Store, count int) (int, []string) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := src.AddUser(ctx, "sync", "secret"); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+	userID, _ := src.Login(ctx, "sync", "secret")
+
+	orders := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		order := utils.SillyGenerateOrderNumberLuhna(12)
+		if err := src.AddOrder(ctx, userID, order, "NEW", 0); err != nil {
+			t.Fatalf("AddOrder() error = %v", err)
+		}
+		orders = append(orders, order)
+	}
+	return userID, orders
+}
+
+func TestSyncAccruals(t *testing.T) {
+	ctx := context.Background()
+	sugar := zap.NewNop().Sugar()
+	src := memory.New()
+	userID, orders := prepare(t, src, 3)
+
+	mock := accrualmock.New(accrualmock.Options{})
+	srv := httptest.NewServer(mock.Handler())
+	defer srv.Close()
+	acc := accrual.New(srv.URL, time.Second, 2, sugar)
+
+	mock.Script(orders[0], accrualmock.Step{Status: "PROCESSING"}, accrualmock.Step{Status: "PROCESSED", Accrual: 50000})
+	mock.Script(orders[1], accrualmock.Step{Status: "INVALID"})
+	mock.Script(orders[2], accrualmock.Step{Code: http.StatusInternalServerError})
+
+	for i := 0; i < 2; i++ {
+		SyncAccruals(ctx, src, acc, sugar, 2, orders...)
+	}
+
+	list, _ := src.GetOrders(ctx, userID)
+	want := map[string]string{orders[0]: "PROCESSED", orders[1]: "INVALID", orders[2]: "NEW"}
+	for _, o := range list {
+		if o.Status != want[o.OrderNumber] {
+			t.Errorf("order %s status = %s, want %s", o.OrderNumber, o.Status, want[o.OrderNumber])
+		}
+	}
+	if balance, _ := src.Balance(ctx, userID); balance.Current != models.Money(50000) {
+		t.Errorf("Balance() = %s, want 500", balance.Current)
+	}
+}
+
+func TestSyncAccruals_TooManyRequests(t *testing.T) {
+	ctx := context.Background()
+	sugar := zap.NewNop().Sugar()
+	src := memory.New()
+	_, orders := prepare(t, src, 5)
+
+	mock := accrualmock.New(accrualmock.Options{})
+	srv := httptest.NewServer(mock.Handler())
+	defer srv.Close()
+	acc := accrual.New(srv.URL, time.Second, 1, sugar)
+
+	for _, order := range orders {
+		mock.Script(order, accrualmock.Step{Code: http.StatusTooManyRequests, RetryAfter: 30})
+	}
+
+	leased, err := src.LeaseOrders(ctx, 10, time.Minute)
+	if err != nil || len(leased) != len(orders) {
+		t.Fatalf("LeaseOrders() = %v, %v", leased, err)
+	}
+	SyncAccruals(ctx, src, acc, sugar, 1, leased...)
+
+	// после первого 429 остальные заказы не запрашиваются
+	requests := 0
+	for _, order := range orders {
+		requests += mock.Requests(order)
+	}
+	if requests != 1 {
+		t.Errorf("accrual requests = %d, want 1", requests)
+	}
+	if _, ok := acc.Paused(); !ok {
+		t.Errorf("Paused() = false, want pause after 429")
+	}
+	// заказы возвращены в очередь с задержкой на время паузы
+	if leased, _ = src.LeaseOrders(ctx, 10, time.Minute); len(leased) != 0 {
+		t.Errorf("LeaseOrders() = %v, want empty during pause", leased)
+	}
+}
+
+// Очередь, сохраняющая ответ accrual только после того, как другой обработчик получил 429
+type lateQueue struct {
+	*memory.Store
+	acc *accrual.Client
+}
+
+func (q *lateQueue) UpdateNotProcessedOrders(ctx context.Context, order, status string, accrual models.Money) error {
+	deadline := time.Now().Add(time.Second)
+	for _, paused := q.acc.Paused(); !paused && time.Now().Before(deadline); _, paused = q.acc.Paused() {
+		time.Sleep(time.Millisecond)
+	}
+	// пакет прерывается сразу после 429
+	time.Sleep(time.Millisecond * 50)
+	return q.Store.UpdateNotProcessedOrders(ctx, order, status, accrual)
+}
+
+func TestSyncAccruals_TooManyRequestsInBatch(t *testing.T) {
+	ctx := context.Background()
+	sugar := zap.NewNop().Sugar()
+	src := memory.New()
+	userID, orders := prepare(t, src, 2)
+
+	mock := accrualmock.New(accrualmock.Options{})
+	srv := httptest.NewServer(mock.Handler())
+	defer srv.Close()
+	acc := accrual.New(srv.URL, time.Second, 2, sugar)
+
+	mock.Script(orders[0], accrualmock.Step{Status: "PROCESSED", Accrual: 50000})
+	mock.Script(orders[1], accrualmock.Step{Code: http.StatusTooManyRequests, RetryAfter: 30, DelayMS: 100})
+
+	leased, err := src.LeaseOrders(ctx, 10, time.Minute)
+	if err != nil || len(leased) != len(orders) {
+		t.Fatalf("LeaseOrders() = %v, %v", leased, err)
+	}
+	SyncAccruals(ctx, &lateQueue{Store: src, acc: acc}, acc, sugar, 2, orders...)
+
+	// ответ 200 сохранён, хотя пакет прерван после 429 другого обработчика
+	list, _ := src.GetOrders(ctx, userID)
+	want := map[string]string{orders[0]: "PROCESSED", orders[1]: "NEW"}
+	for _, o := range list {
+		if o.Status != want[o.OrderNumber] {
+			t.Errorf("order %s status = %s, want %s", o.OrderNumber, o.Status, want[o.OrderNumber])
+		}
+	}
+	if balance, _ := src.Balance(ctx, userID); balance.Current != models.Money(50000) {
+		t.Errorf("Balance() = %s, want 500", balance.Current)
+	}
+	// заказ с 429 возвращён в очередь с задержкой на время паузы
+	if leased, _ = src.LeaseOrders(ctx, 10, time.Minute); len(leased) != 0 {
+		t.Errorf("LeaseOrders() = %v, want empty during pause", leased)
+	}
+}
+
+func TestExpireHolds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sugar := zap.NewNop().Sugar()
+	src := memory.New()
+	userID, _ := prepare(t, src, 0)
+	if err := src.AddOrder(ctx, userID, utils.SillyGenerateOrderNumberLuhna(12), "PROCESSED", 50000); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := src.CreateHold(ctx, userID, utils.SillyGenerateOrderNumberLuhna(12), 10000, time.Now().Add(-time.Second)); err != nil {
+			t.Fatalf("CreateHold() error = %v", err)
+		}
+	}
+	active := utils.SillyGenerateOrderNumberLuhna(12)
+	if _, err := src.CreateHold(ctx, userID, active, 5000, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateHold() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ExpireHolds(ctx, src, sugar, time.Millisecond*10, 2)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if balance, _ := src.Balance(ctx, userID); balance.Held == 5000 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expired holds are not released")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	cancel()
+	<-done
+
+	if balance, _ := src.Balance(context.Background(), userID); balance.Current != 45000 {
+		t.Errorf("Balance() = %s, want 450", balance.Current)
+	}
+}
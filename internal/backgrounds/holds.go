@@ -0,0 +1,45 @@
+package backgrounds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Интерфейс снятия истёкших резервов баллов
+type HoldExpirer interface {
+	// Снятие не более limit истёкших резервов, возвращает количество снятых резервов
+	ExpireHolds(ctx context.Context, limit int) (int, error)
+}
+
+// Функция цикла снятия истёкших резервов баллов, работает до отмены ctx.
+// За один проход снимается не более batch резервов, при полном пакете
+// следующий пакет обрабатывается сразу, не дожидаясь интервала
+func ExpireHolds(ctx context.Context, holds HoldExpirer, sugar *zap.SugaredLogger, interval time.Duration, batch int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			sugar.Infoln("background holds expiry stopped")
+			return
+		case <-ticker.C:
+			for {
+				expired, err := holds.ExpireHolds(ctx, batch)
+				if err != nil {
+					sugar.Infoln(fmt.Sprintf("background holds expiry failed %s", err))
+					break
+				}
+				if expired > 0 {
+					sugar.Infoln(fmt.Sprintf("background holds expired - %d", expired))
+				}
+				if expired < batch || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"testing"
+	"time"
 )
 
 func ExampleFirstValue() {
@@ -25,3 +27,49 @@ func ExampleFirstValue() {
 	// CDE
 	// ABC
 }
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		batch    time.Duration
+		shutdown time.Duration
+		wantErr  bool
+	}{
+		{name: "batch fits shutdown", batch: time.Second * 15, shutdown: time.Second * 30},
+		{name: "batch equals shutdown", batch: time.Second * 30, shutdown: time.Second * 30, wantErr: true},
+		{name: "batch with query exceeds shutdown", batch: time.Second * 25, shutdown: time.Second * 30, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &config{SyncBatchTimeout: tt.batch, QueryTimeout: time.Second * 10, ShutdownTimeout: tt.shutdown}
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFirstSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		set     bool
+		valEnv  bool
+		valFlag bool
+		want    bool
+	}{
+		{name: "env false overrides flag", env: "false", set: true, valEnv: false, valFlag: true, want: false},
+		{name: "env true overrides flag", env: "true", set: true, valEnv: true, valFlag: false, want: true},
+		{name: "flag without env", valFlag: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.set {
+				t.Setenv("CONFIG_TEST_BOOL", tt.env)
+			}
+			if got := FirstSet("CONFIG_TEST_BOOL", &tt.valEnv, &tt.valFlag); got != tt.want {
+				t.Errorf("FirstSet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
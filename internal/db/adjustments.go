@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	errors_api "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Функция ручной корректировки баланса пользователя оператором, возвращает ID корректировки.
+// Положительная сумма зачисляется, отрицательная списывается и не может превысить остаток,
+// кроме изъятия по коду FRAUD, после которого остаток может стать отрицательным.
+// Корректировка проводится по журналу с типом ADJUSTMENT и не учитывается в сумме списаний
+func (s *Store) AddAdjustment(ctx context.Context, userID, operatorID int, amount models.Money, reason, comment string) (int64, error) {
+	sqlUser := `select 1 from ya.users where user_id = $1`
+	sqlAdd := `
+	insert into ya.adjustments (user_id, operator_id, amount, reason_code, comment, created_at)
+	values ($1, $2, $3, $4, nullif($5, ''), now())
+	returning id_adjustment`
+
+	if amount == 0 || !models.ValidAdjustmentReason(reason) {
+		return 0, errors_api.ErrorRegInfo
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorBeginTx.Error(), err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRowContext(ctx, sqlUser, userID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return 0, errors_api.ErrorUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	available, err := lockAccount(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if available+amount < 0 && !models.AdjustmentAllowsNegative(reason) {
+		return 0, errors_api.ErrorInsufficientFunds
+	}
+
+	var adjustmentID int64
+	err = tx.QueryRowContext(ctx, sqlAdd, userID, operatorID, amount, reason, comment).Scan(&adjustmentID)
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	if err = postEntry(ctx, tx, userID, models.EntryAdjustment, strconv.FormatInt(adjustmentID, 10), amount); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+	}
+	return adjustmentID, nil
+}
+
+// Функция получения истории операций по счёту пользователя из журнала в порядке проведения
+func (s *Store) GetHistory(ctx context.Context, userID int) ([]models.HistoryDB, error) {
+	sqlString := `
+	select l.entry_type, l.reference,
+		case when l.direction = 'CREDIT' then l.amount else -l.amount end,
+		coalesce(a.reason_code, ''), l.created_at
+		from ya.ledger l
+		left join ya.adjustments a on l.entry_type = $2 and a.id_adjustment::text = l.reference
+	where l.user_id = $1
+	order by l.id_entry`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, sqlString, userID, models.EntryAdjustment)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	defer rows.Close()
+
+	res := make([]models.HistoryDB, 0)
+	for rows.Next() {
+		var item models.HistoryDB
+		if err = rows.Scan(&item.Type, &item.Reference, &item.Amount, &item.Reason, &item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s %w", errors_api.ErrorScanQuery.Error(), err)
+		}
+		res = append(res, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s %w", errors_api.ErrorScanQuery.Error(), err)
+	}
+	return res, nil
+}
@@ -4,40 +4,77 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	errors_api "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/internal/passwd"
 	"github.com/closable/go-yandex-loyalty/models"
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+// Таймаут запроса к СУБД по умолчанию
+const DefaultQueryTimeout = time.Second * 10
+
 // Структура систмы храненя информации
 type Store struct {
-	DB *sql.DB
+	DB      *sql.DB
+	timeout time.Duration
+	hasher  *passwd.Hasher
+}
+
+// Параметр экземпляра СУБД
+type Option func(s *Store)
+
+// Функция установки таймаута одного запроса к СУБД
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(s *Store) {
+		if timeout > 0 {
+			s.timeout = timeout
+		}
+	}
+}
+
+// Функция установки стоимости хэширования паролей
+func WithPasswordCost(cost int) Option {
+	return func(s *Store) {
+		s.hasher = passwd.New(cost)
+	}
 }
 
 // Функция создания экземпляра СУБД
-func NewDB(connstring string) (*Store, error) {
+func NewDB(connstring string, opts ...Option) (*Store, error) {
 	db, err := sql.Open("pgx", connstring)
 	if err != nil {
 		return nil, err
 	}
-	return &Store{
-		DB: db,
-	}, nil
+	s := &Store{
+		DB:      db,
+		timeout: DefaultQueryTimeout,
+		hasher:  passwd.New(passwd.DefaultCost),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Функция закрытия соединений с СУБД
+func (s *Store) Close() error {
+	return s.DB.Close()
 }
 
 // Функция для подучения connection к СУБД
-func (s *Store) GetConn() (*sql.Conn, error) {
-	ctx := context.Background()
+func (s *Store) GetConn(ctx context.Context) (*sql.Conn, error) {
 	conn, err := s.DB.Conn(ctx)
 
 	return conn, err
 }
 
 // Функция проверки полноты заполнения информации о пользователе
-func (s *Store) ValidateRegisterInfo(login, pass string) error {
+func (s *Store) ValidateRegisterInfo(ctx context.Context, login, pass string) error {
 	// invaid registerinformation
 	if len(login) == 0 || len(pass) == 0 {
 		return errors_api.ErrorRegInfo
@@ -45,7 +82,7 @@ func (s *Store) ValidateRegisterInfo(login, pass string) error {
 
 	// user is present
 	sql := "select count(*) cnt from ya.users where user_name=$1"
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	stmt, err := s.DB.PrepareContext(ctx, sql)
@@ -67,9 +104,17 @@ func (s *Store) ValidateRegisterInfo(login, pass string) error {
 }
 
 // Функция добавления нового пользователя
-func (s *Store) AddUser(login, pass string) error {
-	sql := "insert into ya.users (user_name, user_passw, status) values ($1, sha256($2)::text, true)"
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+func (s *Store) AddUser(ctx context.Context, login, pass string) error {
+	sql := `
+	insert into ya.users (user_name, user_passw, status) values ($1, $2, true)
+	on conflict (user_name) do nothing`
+
+	hash, err := s.hasher.Hash(pass)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	tx, err := s.DB.BeginTx(ctx, nil)
@@ -83,11 +128,16 @@ func (s *Store) AddUser(login, pass string) error {
 		return fmt.Errorf("%s %w", errors_api.ErrorPrepareQuery.Error(), err)
 	}
 
-	_, err = stmt.ExecContext(ctx, login, pass)
+	res, err := stmt.ExecContext(ctx, login, hash)
 	if err != nil {
 		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
 	}
 
+	// пользователь с таким логином уже зарегистрирован
+	if added, err := res.RowsAffected(); err == nil && added == 0 {
+		return errors_api.ErrorConflict
+	}
+
 	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
 	}
@@ -95,19 +145,21 @@ func (s *Store) AddUser(login, pass string) error {
 	return nil
 }
 
-// Функция аутентфикации пользователя
-func (s *Store) Login(login, pass string) (int, error) {
+// Функция аутентфикации пользователя.
+// Устаревший хэш пароля при успешном входе заменяется хэшем с текущими параметрами.
+// Заблокированному пользователю после проверки пароля возвращается ErrorUserBlocked
+func (s *Store) Login(ctx context.Context, login, pass string) (int, error) {
 	sqlString := `
-	select user_id  
+	select user_id, user_passw, status
 		from ya.users u 
-	where u.user_name = $1 and u.user_passw = sha256($2)::text and status`
+	where u.user_name = $1`
 
 	// invaid registerinformation
 	if len(login) == 0 || len(pass) == 0 {
 		return 0, errors_api.ErrorRegInfo
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	stmt, err := s.DB.PrepareContext(ctx, sqlString)
@@ -116,23 +168,53 @@ func (s *Store) Login(login, pass string) (int, error) {
 	}
 
 	var userID int
-	err = stmt.QueryRowContext(ctx, login, pass).Scan(&userID)
+	var hash string
+	var active sql.NullBool
+	err = stmt.QueryRowContext(ctx, login).Scan(&userID, &hash, &active)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
 		}
+		return 0, nil
+	}
+
+	ok, rehash := s.hasher.Verify(hash, pass)
+	if !ok {
+		return 0, nil
+	}
+	if !active.Bool {
+		return 0, errors_api.ErrorUserBlocked
+	}
+	if rehash {
+		if err = s.rehashPassword(ctx, userID, hash, pass); err != nil {
+			return 0, err
+		}
 	}
 	return userID, nil
 }
 
+// Функция замены хэша пароля пользователя, если он не изменился с момента проверки
+func (s *Store) rehashPassword(ctx context.Context, userID int, oldHash, pass string) error {
+	hash, err := s.hasher.Hash(pass)
+	if err != nil {
+		return err
+	}
+
+	sql := `update ya.users set user_passw = $2 where user_id = $1 and user_passw = $3`
+	if _, err = s.DB.ExecContext(ctx, sql, userID, hash, oldHash); err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return nil
+}
+
 // Функция получения списка заказов по userID
-func (s *Store) GetOrders(userID int) ([]models.OrdersDB, error) {
+func (s *Store) GetOrders(ctx context.Context, userID int) ([]models.OrdersDB, error) {
 	sql := `
 	select order_number, status, accrual, uploaded_at
 		from ya.orders 
 		where user_id=$1 order by uploaded_at desc`
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 	res := make([]models.OrdersDB, 0)
 	stmt, err := s.DB.PrepareContext(ctx, sql)
@@ -157,43 +239,48 @@ func (s *Store) GetOrders(userID int) ([]models.OrdersDB, error) {
 	return res, nil
 }
 
-// Функция получеиня баланса
-func (s *Store) Balance(userID int) (float32, float32, error) {
-	sql := `
-	select coalesce(sum(o.accrual),0) current, coalesce((select sum(w.sum) from ya.withdrawals w where user_id=$1),0) withdrawn
-		from ya.orders o 
-		where user_id=$2`
+// Функция получеиня баланса одним чтением строки ya.accounts: доступный остаток
+// без зарезервированных баллов, сумма списаний и сумма резервов
+func (s *Store) Balance(ctx context.Context, userID int) (models.WithdrawDB, error) {
+	sqlString := `
+	select a.balance - a.held current, a.withdrawn, a.held
+	from ya.accounts a where a.user_id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
-	//res := &models.WithdrawDB{}
-	stmt, err := s.DB.PrepareContext(ctx, sql)
+	stmt, err := s.DB.PrepareContext(ctx, sqlString)
 	if err != nil {
-		return 0, 0, fmt.Errorf("%s %w", errors_api.ErrorPrepareQuery.Error(), err)
+		return models.WithdrawDB{}, fmt.Errorf("%s %w", errors_api.ErrorPrepareQuery.Error(), err)
 	}
 
-	var current float32
-	var withdrawn float32
-
-	err = stmt.QueryRowContext(ctx, userID, userID).Scan(&current, &withdrawn)
+	res := models.WithdrawDB{}
+	err = stmt.QueryRowContext(ctx, userID).Scan(&res.Current, &res.Withdrawn, &res.Held)
+	// счёт создаётся первой операцией, до неё баланс нулевой
+	if err == sql.ErrNoRows {
+		return models.WithdrawDB{}, nil
+	}
 	if err != nil {
-		return 0, 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+		return models.WithdrawDB{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
 	}
-	return current, withdrawn, nil
+	return res, nil
 }
 
-// Фукция добавления заказа пользователя
-func (s *Store) AddOrder(userID int, orderNumber, accStatus string, accrual float32) error {
-	sqlString := `
-	select 
-		case when o.user_id = $1 then true else false end is_owner,
-		case when o.status = 'PROCESSING' then 202
-			else 200
-			end status	
-		from ya.orders o 
-		where order_number = $2`
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+// Фукция добавления заказа пользователя.
+// Уникальность номера заказа обеспечивается ограничением orders_number_uq:
+// если номер уже загружен, возвращается ErrorInfoFound (тем же пользователем)
+// или ErrorConflict (другим пользователем)
+func (s *Store) AddOrder(ctx context.Context, userID int, orderNumber, accStatus string, accrual models.Money) error {
+	sqlAdd := `
+	insert into ya.orders 
+		(user_id, order_number, status, accrual, uploaded_at)
+	values 
+		($1, $2, $3, $4, now())
+	on conflict (order_number) do nothing
+	returning id_order`
+
+	sqlOwner := `select o.user_id from ya.orders o where o.order_number = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	tx, err := s.DB.BeginTx(ctx, nil)
@@ -202,41 +289,31 @@ func (s *Store) AddOrder(userID int, orderNumber, accStatus string, accrual floa
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, sqlString)
+	stmt, err := tx.PrepareContext(ctx, sqlAdd)
 	if err != nil {
 		return fmt.Errorf("%s %w", errors_api.ErrorPrepareQuery.Error(), err)
 	}
 
-	var isOwner bool
-	var status int
-
-	err = stmt.QueryRowContext(ctx, userID, orderNumber).Scan(&isOwner, &status)
-	if err != nil && err != sql.ErrNoRows {
-		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
-	}
-
-	if status != 0 {
-		if !isOwner {
+	var orderID int64
+	err = stmt.QueryRowContext(ctx, userID, orderNumber, accStatus, accrual).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		var ownerID int
+		if err = tx.QueryRowContext(ctx, sqlOwner, orderNumber).Scan(&ownerID); err != nil {
+			return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+		}
+		if ownerID != userID {
 			return errors_api.ErrorConflict
-		} else {
-			return errors_api.ErrorInfoFound
 		}
+		return errors_api.ErrorInfoFound
 	}
-
-	sqlAdd := `
-	insert into ya.orders 
-		(user_id, order_number, status, accrual, uploaded_at)
-	values 
-		($1, $2, $3, $4, now())`
-
-	stmt, err = tx.PrepareContext(ctx, sqlAdd)
 	if err != nil {
-		return fmt.Errorf("%s %w", errors_api.ErrorPrepareQuery.Error(), err)
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), mapConstraintError(err))
 	}
 
-	_, err = stmt.ExecContext(ctx, userID, orderNumber, accStatus, accrual)
-	if err != nil {
-		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	if accStatus == "PROCESSED" {
+		if err = postEntry(ctx, tx, userID, models.EntryAccrual, orderNumber, accrual); err != nil {
+			return err
+		}
 	}
 
 	if err = tx.Commit(); err != nil {
@@ -245,11 +322,18 @@ func (s *Store) AddOrder(userID int, orderNumber, accStatus string, accrual floa
 	return nil
 }
 
-// Функция запрос списания баллов/сумм по пользователь
-func (s *Store) AddWithdraw(userID int, orderNumber string, sum float32) error {
-	sql := `insert into ya.withdrawals (user_id, order_number, sum, processed_at) values ($1, $2, $3, now())`
+// Функция запрос списания баллов/сумм по пользователь.
+// Счёт пользователя блокируется до конца транзакции, поэтому доступный
+// остаток проверяется повторно и параллельные списания не могут превысить баланс
+func (s *Store) AddWithdraw(ctx context.Context, userID int, orderNumber string, sum models.Money) error {
+	sqlAdd := `insert into ya.withdrawals (user_id, order_number, sum, processed_at) values ($1, $2, $3, now())`
+	sqlHeld := `select exists (select 1 from ya.withdraw_holds where order_number = $1 and status = $2)`
+
+	if sum <= 0 {
+		return errors_api.ErrorRegInfo
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	tx, err := s.DB.BeginTx(ctx, nil)
@@ -258,16 +342,42 @@ func (s *Store) AddWithdraw(userID int, orderNumber string, sum float32) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, sql)
+	available, err := lockAccount(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	// check balance
+	if available < sum {
+		return errors_api.ErrorInsufficientFunds
+	}
+
+	// заказ с действующим резервом списывается только подтверждением резерва
+	var held bool
+	if err = tx.QueryRowContext(ctx, sqlHeld, orderNumber, models.HoldHeld).Scan(&held); err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if held {
+		return errors_api.ErrorConflict
+	}
+
+	stmt, err := tx.PrepareContext(ctx, sqlAdd)
 	if err != nil {
 		return fmt.Errorf("%s %w", errors_api.ErrorPrepareQuery.Error(), err)
 	}
 	// add withdraw
 	_, err = stmt.ExecContext(ctx, userID, orderNumber, sum)
 	if err != nil {
+		if err = mapConstraintError(err); errors.Is(err, errors_api.ErrorConflict) {
+			return err
+		}
 		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
 	}
 
+	if err = postEntry(ctx, tx, userID, models.EntryWithdrawal, orderNumber, -sum); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
 	}
@@ -276,14 +386,14 @@ func (s *Store) AddWithdraw(userID int, orderNumber string, sum float32) error {
 }
 
 // Функция запрос на получение всех списаний баллов/сумм
-func (s *Store) GetWithdrawals(userID int) ([]models.WithdrawGetDB, error) {
-	sql := `select w.order_number, w.sum, w.processed_at from ya.withdrawals w where w.user_id=$1`
+func (s *Store) GetWithdrawals(ctx context.Context, userID int) ([]models.WithdrawGetDB, error) {
+	sqlString := `select w.order_number, w.sum, w.processed_at, w.reversed_at from ya.withdrawals w where w.user_id=$1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 	res := make([]models.WithdrawGetDB, 0)
 
-	stmt, err := s.DB.PrepareContext(ctx, sql)
+	stmt, err := s.DB.PrepareContext(ctx, sqlString)
 	if err != nil {
 		return res, fmt.Errorf("%s %w", errors_api.ErrorPrepareQuery.Error(), err)
 	}
@@ -295,73 +405,49 @@ func (s *Store) GetWithdrawals(userID int) ([]models.WithdrawGetDB, error) {
 
 	for rows.Next() {
 		item := models.WithdrawGetDB{}
-		err = rows.Scan(&item.Order, &item.Sum, &item.ProcessedAt)
+		var reversedAt sql.NullString
+		err = rows.Scan(&item.Order, &item.Sum, &item.ProcessedAt, &reversedAt)
 		if err != nil {
 			return res, fmt.Errorf("%s %w", errors_api.ErrorScanQuery.Error(), err)
 		}
+		item.ReversedAt = reversedAt.String
 		res = append(res, item)
 
 	}
 	return res, nil
 }
 
-// Сервисная функция, реализующая первоначальное состояние таблиц данных
-func (s *Store) PrepareDB() error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-	pipe := make([]string, 4)
-	pipe[0] = `CREATE SCHEMA IF NOT EXISTS ya AUTHORIZATION postgres`
-	pipe[1] = `CREATE TABLE IF NOT EXISTS ya.users
-				(
-					user_id bigserial NOT NULL,
-					user_name character varying(255) COLLATE pg_catalog."default" NOT NULL,
-					user_passw character varying(100) COLLATE pg_catalog."default" NOT NULL,
-					status boolean DEFAULT false,
-					CONSTRAINT user_pkey PRIMARY KEY (user_id)
-				)`
-	pipe[2] = `CREATE TABLE IF NOT EXISTS ya.orders
-				(
-					id_order bigserial NOT NULL,
-					user_id integer NOT NULL,
-					order_number character varying(20) COLLATE pg_catalog."default" NOT NULL,
-					status character varying(20) COLLATE pg_catalog."default" NOT NULL,
-					accrual numeric(10,2) DEFAULT 0.0,
-					uploaded_at timestamp with time zone,
-					CONSTRAINT orders_pkey PRIMARY KEY (id_order)
-				)`
-	pipe[3] = `CREATE TABLE IF NOT EXISTS ya.withdrawals
-				(
-					id_withdraw bigserial NOT NULL,
-					user_id integer NOT NULL,
-					order_number character varying(20) COLLATE pg_catalog."default" NOT NULL,
-					sum numeric(10,2) DEFAULT 0.0,
-					processed_at timestamp with time zone,
-					CONSTRAINT withdrawals_pkey PRIMARY KEY (id_withdraw)
-				)`
-
-	for ind, sql := range pipe {
-		_, err := s.DB.ExecContext(ctx, sql)
-		if err != nil {
-			fmt.Println(ind, sql, err)
-			return err
-		}
-	}
-
-	return nil
-}
-
-// Сервисная функция для выборки всех необработанных заказов для дальнейшей синхронизации с accrual системой
-func (s *Store) NotProcessedOrders() ([]string, error) {
-	sql := `select order_number from ya.orders where status not in ('INVALID', 'PROCESSED')`
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+// Сервисная функция для захвата (аренды) необработанных заказов для дальнейшей синхронизации с accrual системой
+//
+//	limit int максимальное количество заказов
+//	lease time.Duration время аренды, в течение которого заказы не выдаются другим экземплярам
+//
+// Заказы, захваченные другой транзакцией, пропускаются (FOR UPDATE SKIP LOCKED),
+// поэтому несколько экземпляров приложения могут обрабатывать очередь одновременно
+func (s *Store) LeaseOrders(ctx context.Context, limit int, lease time.Duration) ([]string, error) {
+	sql := `
+	update ya.orders o
+		set locked_until = now() + $2::float8 * interval '1 second'
+	where o.id_order in (
+		select q.id_order
+			from ya.orders q
+		where q.status not in ('INVALID', 'PROCESSED')
+			and q.next_attempt_at <= now()
+			and (q.locked_until is null or q.locked_until < now())
+		order by q.next_attempt_at
+		limit $1
+		for update skip locked)
+	returning o.order_number`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 	res := make([]string, 0)
 
-	rows, err := s.DB.QueryContext(ctx, sql)
-	if err != nil || rows.Err() != nil {
+	rows, err := s.DB.QueryContext(ctx, sql, limit, lease.Seconds())
+	if err != nil {
 		return res, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		order := ""
@@ -372,13 +458,71 @@ func (s *Store) NotProcessedOrders() ([]string, error) {
 		res = append(res, order)
 
 	}
+	if err = rows.Err(); err != nil {
+		return res, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
 	return res, nil
 }
 
-func (s *Store) UpdateNotProcessedOrders(order, status string, accrual float32) error {
-	sql := `update ya.orders SET status = $2, accrual = $3 where order_number = $1`
+// Функция переноса заказа на повторную обработку с экспоненциальной задержкой,
+// после RetryMaxAttempts попыток заказ опрашивается с задержкой RetryMaxDelay
+func (s *Store) RetryOrder(ctx context.Context, order string) error {
+	sql := `
+	update ya.orders
+		set attempts = least(attempts + 1, $4),
+			locked_until = null,
+			next_attempt_at = now() + least($2::float8 * power(2, least(attempts, $4)), $3::float8) * interval '1 second'
+	where order_number = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, sql, order, models.RetryBaseDelay.Seconds(), models.RetryMaxDelay.Seconds(), models.RetryMaxAttempts)
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	return nil
+}
+
+// Функция возврата захваченных заказов в очередь без учёта попытки,
+// заказы станут доступны для обработки не ранее чем через delay
+func (s *Store) ReleaseOrders(ctx context.Context, delay time.Duration, orders ...string) error {
+	sql := `
+	update ya.orders
+		set locked_until = null,
+			next_attempt_at = greatest(next_attempt_at, now() + $2::float8 * interval '1 second')
+	where order_number = any($1)`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, sql, orders, delay.Seconds())
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	return nil
+}
+
+// Функция обновления состояния заказа по данным accrual системы,
+// заказы с неокончательным статусом опрашиваются повторно через PollInterval без учёта попытки.
+// Окончательный статус заказа не изменяется повторным или запоздавшим ответом
+func (s *Store) UpdateNotProcessedOrders(ctx context.Context, order, status string, accrual models.Money) error {
+	sqlString := `
+	update ya.orders
+		set status = $2::varchar,
+			accrual = $3,
+			locked_until = null,
+			attempts = 0,
+			next_attempt_at = case when $2::varchar in ('INVALID', 'PROCESSED') then next_attempt_at
+				else now() + $4::float8 * interval '1 second'
+				end
+	where order_number = $1
+		and status not in ('INVALID', 'PROCESSED')
+	returning user_id`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	tx, err := s.DB.BeginTx(ctx, nil)
@@ -387,19 +531,43 @@ func (s *Store) UpdateNotProcessedOrders(order, status string, accrual float32)
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, sql)
+	stmt, err := tx.PrepareContext(ctx, sqlString)
 	if err != nil {
 		return fmt.Errorf("%s %w", errors_api.ErrorPrepareQuery.Error(), err)
 	}
 
-	_, err = stmt.ExecContext(ctx, order, status, accrual)
+	var userID int
+	err = stmt.QueryRowContext(ctx, order, status, accrual, models.PollInterval.Seconds()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// статус заказа уже окончательный
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
 	}
 
+	// начисление проводится один раз, когда расчёт окончен
+	if status == "PROCESSED" {
+		if err = postEntry(ctx, tx, userID, models.EntryAccrual, order, accrual); err != nil {
+			return err
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
 	}
 
 	return nil
 }
+
+// Код ошибки PostgreSQL unique_violation
+const uniqueViolation = "23505"
+
+// Функция преобразования ошибки нарушения уникальности СУБД в ErrorConflict
+func mapConstraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return errors_api.ErrorConflict
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/db"
+	"github.com/closable/go-yandex-loyalty/internal/handlers"
+	"github.com/closable/go-yandex-loyalty/internal/migrations"
+	"github.com/closable/go-yandex-loyalty/internal/passwd"
+	"github.com/closable/go-yandex-loyalty/internal/storetest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Контрактные тесты выполняются на отдельной СУБД, адрес которой задан в TEST_DATABASE_URI
+func TestStore_Contract(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	storetest.Run(t, func(t *testing.T) handlers.Sourcer {
+		src, err := db.NewDB(dsn, db.WithPasswordCost(bcrypt.MinCost))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { src.Close() })
+
+		if _, err = migrations.Up(context.Background(), src.DB); err != nil {
+			t.Fatal(err)
+		}
+		return src
+	})
+}
+
+// Устаревший хэш sha256 заменяется bcrypt при успешном входе
+func TestStore_LoginUpgradesLegacyHash(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	ctx := context.Background()
+
+	src, err := db.NewDB(dsn, db.WithPasswordCost(bcrypt.MinCost))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if _, err = migrations.Up(ctx, src.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	login := fmt.Sprintf("legacy-%d", time.Now().UnixNano())
+	_, err = src.DB.ExecContext(ctx,
+		`insert into ya.users (user_name, user_passw, status) values ($1, $2, true)`, login, passwd.Legacy("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userID, err := src.Login(ctx, login, "wrong"); err != nil || userID != 0 {
+		t.Errorf("Login() wrong password = %d, %v, want 0", userID, err)
+	}
+	if userID, err := src.Login(ctx, login, "secret"); err != nil || userID == 0 {
+		t.Fatalf("Login() = %d, %v, want user", userID, err)
+	}
+
+	var hash string
+	if err = src.DB.QueryRowContext(ctx, `select user_passw from ya.users where user_name = $1`, login).Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$2") {
+		t.Errorf("password hash = %s, want bcrypt", hash)
+	}
+	if userID, err := src.Login(ctx, login, "secret"); err != nil || userID == 0 {
+		t.Errorf("Login() after upgrade = %d, %v, want user", userID, err)
+	}
+}
@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	errors_api "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Функция резервирования баллов пользователя под списание по заказу до expiresAt.
+// Резерв уменьшает доступный остаток, но не проводится по журналу до подтверждения
+func (s *Store) CreateHold(ctx context.Context, userID int, orderNumber string, sum models.Money, expiresAt time.Time) (models.HoldDB, error) {
+	sqlWithdrawn := `select exists (select 1 from ya.withdrawals where order_number = $1)`
+	sqlAdd := `
+	insert into ya.withdraw_holds (order_number, user_id, sum, status, created_at, expires_at)
+	values ($1, $2, $3, $4, now(), $5)
+	on conflict (order_number) do nothing
+	returning created_at, expires_at`
+
+	if sum <= 0 || len(orderNumber) > models.MaxOrderNumberLen {
+		return models.HoldDB{}, errors_api.ErrorRegInfo
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.HoldDB{}, fmt.Errorf("%s %w", errors_api.ErrorBeginTx.Error(), err)
+	}
+	defer tx.Rollback()
+
+	available, err := lockAccount(ctx, tx, userID)
+	if err != nil {
+		return models.HoldDB{}, err
+	}
+	if available < sum {
+		return models.HoldDB{}, errors_api.ErrorInsufficientFunds
+	}
+
+	var withdrawn bool
+	if err = tx.QueryRowContext(ctx, sqlWithdrawn, orderNumber).Scan(&withdrawn); err != nil {
+		return models.HoldDB{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if withdrawn {
+		return models.HoldDB{}, errors_api.ErrorConflict
+	}
+
+	hold := models.HoldDB{Order: orderNumber, Sum: sum, Status: models.HoldHeld}
+	err = tx.QueryRowContext(ctx, sqlAdd, orderNumber, userID, sum, models.HoldHeld, expiresAt).Scan(&hold.CreatedAt, &hold.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return models.HoldDB{}, errors_api.ErrorConflict
+	}
+	if err != nil {
+		return models.HoldDB{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	if err = addHeld(ctx, tx, userID, sum); err != nil {
+		return models.HoldDB{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.HoldDB{}, fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+	}
+	return hold, nil
+}
+
+// Функция подтверждения резерва: зарезервированные баллы списываются по заказу резерва.
+// Для уже подтверждённого резерва возвращает его и ErrorInfoFound.
+// userID ограничивает поиск резервами пользователя, 0 — любой резерв
+func (s *Store) CaptureHold(ctx context.Context, userID int, orderNumber string) (models.HoldDB, error) {
+	sqlAdd := `insert into ya.withdrawals (user_id, order_number, sum, processed_at) values ($1, $2, $3, now())`
+
+	return s.closeHold(ctx, userID, orderNumber, models.HoldCaptured, func(tx *sql.Tx, hold *holdRow) error {
+		if !hold.expiresAt.After(time.Now()) {
+			return errors_api.ErrorHoldClosed
+		}
+		if _, err := tx.ExecContext(ctx, sqlAdd, hold.userID, orderNumber, hold.Sum); err != nil {
+			if err = mapConstraintError(err); errors.Is(err, errors_api.ErrorConflict) {
+				return err
+			}
+			return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+		}
+		if err := addHeld(ctx, tx, hold.userID, -hold.Sum); err != nil {
+			return err
+		}
+		return postEntry(ctx, tx, hold.userID, models.EntryWithdrawal, orderNumber, -hold.Sum)
+	})
+}
+
+// Функция отмены резерва, баллы снова становятся доступны.
+// Для уже отменённого или истёкшего резерва возвращает его и ErrorInfoFound.
+// userID ограничивает поиск резервами пользователя, 0 — любой резерв
+func (s *Store) ReleaseHold(ctx context.Context, userID int, orderNumber string) (models.HoldDB, error) {
+	return s.closeHold(ctx, userID, orderNumber, models.HoldReleased, func(tx *sql.Tx, hold *holdRow) error {
+		return addHeld(ctx, tx, hold.userID, -hold.Sum)
+	})
+}
+
+// Функция снятия не более limit истёкших резервов, возвращает количество снятых резервов.
+// Резервы, захваченные параллельным подтверждением или отменой, пропускаются
+func (s *Store) ExpireHolds(ctx context.Context, limit int) (int, error) {
+	sqlExpire := `
+	update ya.withdraw_holds
+		set status = $2, closed_at = now()
+	where order_number in (
+		select order_number from ya.withdraw_holds
+		where status = $3 and expires_at <= now()
+		order by expires_at
+		limit $1
+		for update skip locked)
+	returning user_id, sum`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorBeginTx.Error(), err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, sqlExpire, limit, models.HoldExpired, models.HoldHeld)
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	expired := 0
+	released := make(map[int]models.Money)
+	for rows.Next() {
+		var userID int
+		var sum models.Money
+		if err = rows.Scan(&userID, &sum); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s %w", errors_api.ErrorScanQuery.Error(), err)
+		}
+		released[userID] += sum
+		expired++
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorScanQuery.Error(), err)
+	}
+
+	// счета блокируются в порядке ID пользователя, чтобы параллельные экземпляры не взаимоблокировались
+	userIDs := make([]int, 0, len(released))
+	for userID := range released {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
+	for _, userID := range userIDs {
+		if err = addHeld(ctx, tx, userID, -released[userID]); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+	}
+	return expired, nil
+}
+
+// Резерв, заблокированный до конца транзакции
+type holdRow struct {
+	models.HoldDB
+	userID    int
+	expiresAt time.Time
+}
+
+// Функция перевода резерва в состояние status. Резерв блокируется до конца транзакции,
+// apply выполняет изменения счёта. Резерв в состоянии status возвращается с ErrorInfoFound,
+// в другом конечном состоянии — ErrorHoldClosed
+func (s *Store) closeHold(ctx context.Context, userID int, orderNumber, status string, apply func(tx *sql.Tx, hold *holdRow) error) (models.HoldDB, error) {
+	sqlSelect := `
+	select user_id, sum, status, created_at, expires_at
+		from ya.withdraw_holds
+	where order_number = $1 and ($2 = 0 or user_id = $2)
+	for update`
+	sqlClose := `update ya.withdraw_holds set status = $2, closed_at = now() where order_number = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.HoldDB{}, fmt.Errorf("%s %w", errors_api.ErrorBeginTx.Error(), err)
+	}
+	defer tx.Rollback()
+
+	hold := &holdRow{HoldDB: models.HoldDB{Order: orderNumber}}
+	err = tx.QueryRowContext(ctx, sqlSelect, orderNumber, userID).Scan(&hold.userID, &hold.Sum, &hold.Status, &hold.CreatedAt, &hold.expiresAt)
+	if err == sql.ErrNoRows {
+		return models.HoldDB{}, errors_api.ErrorHoldNotFound
+	}
+	if err != nil {
+		return models.HoldDB{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	hold.ExpiresAt = hold.expiresAt.Format(time.RFC3339Nano)
+
+	switch {
+	case hold.Status == status,
+		// истёкший резерв уже отменён
+		status == models.HoldReleased && hold.Status == models.HoldExpired:
+		return hold.HoldDB, errors_api.ErrorInfoFound
+	case hold.Status != models.HoldHeld:
+		return hold.HoldDB, errors_api.ErrorHoldClosed
+	}
+
+	if err = apply(tx, hold); err != nil {
+		return models.HoldDB{}, err
+	}
+	if _, err = tx.ExecContext(ctx, sqlClose, orderNumber, status); err != nil {
+		return models.HoldDB{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.HoldDB{}, fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+	}
+	hold.Status = status
+	return hold.HoldDB, nil
+}
+
+// Функция изменения суммы зарезервированных баллов на счёте пользователя внутри транзакции tx
+func addHeld(ctx context.Context, tx *sql.Tx, userID int, delta models.Money) error {
+	sqlString := `update ya.accounts set held = held + $2, updated_at = now() where user_id = $1`
+
+	if _, err := tx.ExecContext(ctx, sqlString, userID, delta); err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return nil
+}
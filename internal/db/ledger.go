@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	errors_api "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Системные (корреспондирующие) счета журнала, по одному на тип проводки
+var systemAccounts = map[string]string{
+	models.EntryAccrual:    "system:accruals",
+	models.EntryWithdrawal: "system:withdrawals",
+	models.EntryAdjustment: "system:adjustments",
+	models.EntryReversal:   "system:withdrawals",
+}
+
+// Функция формирования имени счёта пользователя в журнале
+func userAccount(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// Функция блокировки счёта пользователя до конца транзакции,
+// при отсутствии счёт создаётся, возвращает доступный остаток без зарезервированных баллов
+func lockAccount(ctx context.Context, tx *sql.Tx, userID int) (models.Money, error) {
+	sqlCreate := `insert into ya.accounts (user_id) values ($1) on conflict (user_id) do nothing`
+	sqlLock := `select balance - held from ya.accounts where user_id = $1 for update`
+
+	if _, err := tx.ExecContext(ctx, sqlCreate, userID); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	var balance models.Money
+	if err := tx.QueryRowContext(ctx, sqlLock, userID).Scan(&balance); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return balance, nil
+}
+
+// Функция проводки по счёту пользователя внутри транзакции tx.
+// Проводка записывается в журнал двумя строками (счёт пользователя и системный счёт),
+// положительная сумма зачисляется пользователю, отрицательная списывается.
+// Повторная проводка того же типа по той же ссылке игнорируется.
+// Остаток в ya.accounts изменяется в той же транзакции
+func postEntry(ctx context.Context, tx *sql.Tx, userID int, entryType, reference string, amount models.Money) error {
+	if amount == 0 {
+		return nil
+	}
+
+	if _, err := lockAccount(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	userSide, systemSide := "CREDIT", "DEBIT"
+	value := amount
+	if amount < 0 {
+		userSide, systemSide = "DEBIT", "CREDIT"
+		value = -amount
+	}
+
+	var postingID int64
+	err := tx.QueryRowContext(ctx, `select nextval('ya.ledger_posting_seq')`).Scan(&postingID)
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	sqlEntry := `
+	insert into ya.ledger
+		(posting_id, account, user_id, direction, amount, entry_type, reference, created_at)
+	values
+		($1, $2, $3, $4, $5, $6, $7, now())
+	on conflict (entry_type, reference, account) do nothing
+	returning id_entry`
+
+	var entryID int64
+	err = tx.QueryRowContext(ctx, sqlEntry, postingID, userAccount(userID), userID, userSide, value, entryType, reference).Scan(&entryID)
+	if err == sql.ErrNoRows {
+		// проводка уже выполнена ранее
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	_, err = tx.ExecContext(ctx, sqlEntry, postingID, systemAccounts[entryType], nil, systemSide, value, entryType, reference)
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	// возврат уменьшает сумму списаний на сумму отменённого списания
+	var withdrawn models.Money
+	if entryType == models.EntryWithdrawal || entryType == models.EntryReversal {
+		withdrawn = -amount
+	}
+
+	sqlAccount := `
+	update ya.accounts
+		set balance = balance + $2,
+			withdrawn = withdrawn + $3,
+			updated_at = now()
+	where user_id = $1`
+
+	if _, err = tx.ExecContext(ctx, sqlAccount, userID, amount, withdrawn); err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return nil
+}
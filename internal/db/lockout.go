@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	errors_api "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/internal/lockout"
+)
+
+// Функция получения времени, до которого вход по логину или с IP адреса запрещён.
+// Нулевое время означает, что вход разрешён
+func (s *Store) LoginLockedUntil(ctx context.Context, login, ip string) (time.Time, error) {
+	sqlString := `
+	select greatest(
+		(select locked_until from ya.users where user_name = $1),
+		(select locked_until from ya.login_attempts where ip = $2))`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var until sql.NullTime
+	if err := s.DB.QueryRowContext(ctx, sqlString, login, ip).Scan(&until); err != nil {
+		return time.Time{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return until.Time, nil
+}
+
+// Функция учёта неудачной попытки входа по логину и IP адресу.
+// Возвращает время, до которого следующая попытка запрещена правилами policy
+func (s *Store) AddLoginFailure(ctx context.Context, login, ip string, policy lockout.Policy) (time.Time, error) {
+	sqlUser := `
+	update ya.users
+		set failed_logins = case when last_failed_at > now() - $2 * interval '1 second' then failed_logins + 1 else 1 end,
+			last_failed_at = now()
+	where user_name = $1
+	returning failed_logins`
+	sqlIP := `
+	insert into ya.login_attempts as a (ip, failures, last_failed_at) values ($1, 1, now())
+	on conflict (ip) do update
+		set failures = case when a.last_failed_at > now() - $2 * interval '1 second' then a.failures + 1 else 1 end,
+			last_failed_at = now()
+	returning failures`
+	sqlLockUser := `update ya.users set locked_until = $2 where user_name = $1`
+	sqlLockIP := `update ya.login_attempts set locked_until = $2 where ip = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s %w", errors_api.ErrorBeginTx.Error(), err)
+	}
+	defer tx.Rollback()
+
+	window := policy.Window.Seconds()
+	now := time.Now()
+
+	// неизвестный логин не учитывается, попытки ограничиваются счётчиком IP адреса
+	var until time.Time
+	var failures int
+	err = tx.QueryRowContext(ctx, sqlUser, login, window).Scan(&failures)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if err == nil {
+		until = policy.Login.Until(failures, now)
+		if _, err = tx.ExecContext(ctx, sqlLockUser, login, nullTime(until)); err != nil {
+			return time.Time{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+		}
+	}
+
+	if err = tx.QueryRowContext(ctx, sqlIP, ip, window).Scan(&failures); err != nil {
+		return time.Time{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	ipUntil := policy.IP.Until(failures, now)
+	if _, err = tx.ExecContext(ctx, sqlLockIP, ip, nullTime(ipUntil)); err != nil {
+		return time.Time{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return time.Time{}, fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+	}
+	if ipUntil.After(until) {
+		until = ipUntil
+	}
+	return until, nil
+}
+
+// Функция сброса счётчика неудачных попыток входа по логину после успешного входа.
+// Счётчик IP адреса не сбрасывается, чтобы вход в свою учётную запись не открывал перебор чужих
+func (s *Store) ResetLoginFailures(ctx context.Context, login string) error {
+	sql := `
+	update ya.users
+		set failed_logins = 0, last_failed_at = null, locked_until = null
+	where user_name = $1 and (failed_logins > 0 or locked_until is not null)`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if _, err := s.DB.ExecContext(ctx, sql, login); err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return nil
+}
+
+// Функция преобразования нулевого времени в NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
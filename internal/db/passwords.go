@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	errors_api "github.com/closable/go-yandex-loyalty/internal/errors"
+)
+
+// Функция смены пароля пользователя после проверки текущего пароля
+func (s *Store) ChangePassword(ctx context.Context, userID int, current, next string) error {
+	sqlSelect := `select user_passw from ya.users where user_id = $1 and status`
+	sqlUpdate := `update ya.users set user_passw = $2 where user_id = $1 and user_passw = $3`
+
+	if len(next) == 0 {
+		return errors_api.ErrorRegInfo
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var oldHash string
+	err := s.DB.QueryRowContext(ctx, sqlSelect, userID).Scan(&oldHash)
+	if err == sql.ErrNoRows {
+		return errors_api.ErrorWrongPassword
+	}
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	if ok, _ := s.hasher.Verify(oldHash, current); !ok {
+		return errors_api.ErrorWrongPassword
+	}
+	hash, err := s.hasher.Hash(next)
+	if err != nil {
+		return err
+	}
+
+	// пароль изменён параллельным запросом после проверки
+	res, err := s.DB.ExecContext(ctx, sqlUpdate, userID, hash, oldHash)
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if updated, err := res.RowsAffected(); err == nil && updated == 0 {
+		return errors_api.ErrorConflict
+	}
+	return nil
+}
+
+// Функция сохранения хэша токена сброса пароля пользователя login, прежние токены пользователя
+// перестают действовать. Для неизвестного или заблокированного пользователя возвращает 0
+func (s *Store) CreatePasswordReset(ctx context.Context, login, tokenHash string, expiresAt time.Time) (int, error) {
+	sqlSelect := `select user_id from ya.users where user_name = $1 and status`
+	sqlExpire := `update ya.password_resets set used_at = now() where user_id = $1 and used_at is null`
+	sqlInsert := `
+	insert into ya.password_resets (token_hash, user_id, created_at, expires_at)
+	values ($1, $2, now(), $3)`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorBeginTx.Error(), err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRowContext(ctx, sqlSelect, login).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlExpire, userID); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if _, err = tx.ExecContext(ctx, sqlInsert, tokenHash, userID, expiresAt); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+	}
+	return userID, nil
+}
+
+// Функция установки нового пароля по одноразовому токену сброса, возвращает ID пользователя.
+// Сброс пароля снимает блокировку входа пользователя
+func (s *Store) ResetPassword(ctx context.Context, tokenHash, pass string) (int, error) {
+	sqlUse := `
+	update ya.password_resets
+		set used_at = now()
+	where token_hash = $1 and used_at is null and expires_at > now()
+	returning user_id`
+	sqlUpdate := `
+	update ya.users
+		set user_passw = $2, failed_logins = 0, last_failed_at = null, locked_until = null
+	where user_id = $1 and status`
+
+	if len(pass) == 0 {
+		return 0, errors_api.ErrorRegInfo
+	}
+	hash, err := s.hasher.Hash(pass)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorBeginTx.Error(), err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRowContext(ctx, sqlUse, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, errors_api.ErrorResetInvalid
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	res, err := tx.ExecContext(ctx, sqlUpdate, userID, hash)
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if updated, err := res.RowsAffected(); err == nil && updated == 0 {
+		return 0, errors_api.ErrorResetInvalid
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	errors_api "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Функция отмены списания по номеру заказа: баллы возвращаются на счёт пользователя
+// проводкой REVERSAL, исходное списание сохраняется с отметкой об отмене.
+// Для уже отменённого списания возвращает его и ErrorInfoFound
+func (s *Store) ReverseWithdraw(ctx context.Context, orderNumber, reversedBy, reason string) (models.WithdrawGetDB, error) {
+	sqlSelect := `
+	select user_id, sum, processed_at, reversed_at
+		from ya.withdrawals
+	where order_number = $1
+	for update`
+	sqlReverse := `
+	update ya.withdrawals
+		set reversed_at = now(), reversed_by = $2, reversal_reason = nullif($3, '')
+	where order_number = $1
+	returning reversed_at`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.WithdrawGetDB{}, fmt.Errorf("%s %w", errors_api.ErrorBeginTx.Error(), err)
+	}
+	defer tx.Rollback()
+
+	item := models.WithdrawGetDB{Order: orderNumber}
+	var userID int
+	var reversedAt sql.NullString
+	err = tx.QueryRowContext(ctx, sqlSelect, orderNumber).Scan(&userID, &item.Sum, &item.ProcessedAt, &reversedAt)
+	if err == sql.ErrNoRows {
+		return models.WithdrawGetDB{}, errors_api.ErrorWithdrawNotFound
+	}
+	if err != nil {
+		return models.WithdrawGetDB{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if reversedAt.Valid {
+		item.ReversedAt = reversedAt.String
+		return item, errors_api.ErrorInfoFound
+	}
+
+	if err = tx.QueryRowContext(ctx, sqlReverse, orderNumber, reversedBy, reason).Scan(&item.ReversedAt); err != nil {
+		return models.WithdrawGetDB{}, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if err = postEntry(ctx, tx, userID, models.EntryReversal, orderNumber, item.Sum); err != nil {
+		return models.WithdrawGetDB{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.WithdrawGetDB{}, fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+	}
+	return item, nil
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	errors_api "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Функция получения роли пользователя
+func (s *Store) UserRole(ctx context.Context, userID int) (string, error) {
+	sqlString := `select user_role from ya.users where user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var role string
+	err := s.DB.QueryRowContext(ctx, sqlString, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", errors_api.ErrorUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return role, nil
+}
+
+// Функция назначения роли пользователю
+func (s *Store) SetUserRole(ctx context.Context, userID int, role string) error {
+	return s.setRole(ctx, `update ya.users set user_role = $2 where user_id = $1`, userID, role)
+}
+
+// Функция назначения роли пользователю по логину, используется для назначения
+// первого администратора из командной строки
+func (s *Store) SetRoleByLogin(ctx context.Context, login, role string) error {
+	return s.setRole(ctx, `update ya.users set user_role = $2 where user_name = $1`, login, role)
+}
+
+// Функция выполнения запроса назначения роли
+func (s *Store) setRole(ctx context.Context, sqlString string, user any, role string) error {
+	if !models.ValidRole(role) {
+		return errors_api.ErrorRegInfo
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, sqlString, user, role)
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if updated, err := res.RowsAffected(); err == nil && updated == 0 {
+		return errors_api.ErrorUserNotFound
+	}
+	return nil
+}
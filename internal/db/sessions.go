@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	errors_api "github.com/closable/go-yandex-loyalty/internal/errors"
+)
+
+// Функция создания сессии пользователя с хэшем refresh токена
+func (s *Store) CreateSession(ctx context.Context, userID int, sessionID, refreshHash string, expiresAt time.Time) error {
+	sql := `
+	insert into ya.sessions (session_id, user_id, refresh_hash, created_at, expires_at)
+	values ($1, $2, $3, now(), $4)`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if _, err := s.DB.ExecContext(ctx, sql, sessionID, userID, refreshHash, expiresAt); err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return nil
+}
+
+// Функция замены refresh токена сессии, возвращает ID пользователя.
+// Если предъявлен не текущий токен сессии (токен уже использовался и мог быть похищен),
+// сессия отзывается и возвращается ErrorSessionInvalid
+func (s *Store) RotateSession(ctx context.Context, sessionID, refreshHash, newHash string, expiresAt time.Time) (int, error) {
+	sqlSelect := `
+	select user_id, refresh_hash, expires_at > now() and revoked_at is null
+		from ya.sessions
+	where session_id = $1
+	for update`
+	sqlRevoke := `update ya.sessions set revoked_at = now() where session_id = $1 and revoked_at is null`
+	sqlRotate := `
+	update ya.sessions
+		set refresh_hash = $2,
+			expires_at = $3,
+			rotated_at = now()
+	where session_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorBeginTx.Error(), err)
+	}
+	defer tx.Rollback()
+
+	var (
+		userID int
+		hash   string
+		active bool
+	)
+	err = tx.QueryRowContext(ctx, sqlSelect, sessionID).Scan(&userID, &hash, &active)
+	if err == sql.ErrNoRows {
+		return 0, errors_api.ErrorSessionInvalid
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if !active {
+		return 0, errors_api.ErrorSessionInvalid
+	}
+
+	if hash != refreshHash {
+		if _, err = tx.ExecContext(ctx, sqlRevoke, sessionID); err != nil {
+			return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+		}
+		if err = tx.Commit(); err != nil {
+			return 0, fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+		}
+		return 0, errors_api.ErrorSessionInvalid
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlRotate, sessionID, newHash, expiresAt); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+	}
+	return userID, nil
+}
+
+// Функция отзыва сессии пользователя
+func (s *Store) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	sql := `update ya.sessions set revoked_at = now() where session_id = $1 and user_id = $2 and revoked_at is null`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if _, err := s.DB.ExecContext(ctx, sql, sessionID, userID); err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return nil
+}
+
+// Функция отзыва всех сессий пользователя
+func (s *Store) RevokeSessions(ctx context.Context, userID int) error {
+	sql := `update ya.sessions set revoked_at = now() where user_id = $1 and revoked_at is null`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if _, err := s.DB.ExecContext(ctx, sql, userID); err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return nil
+}
+
+// Функция проверки, что сессия не отозвана и не истекла
+func (s *Store) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	sql := `
+	select exists(
+		select 1 from ya.sessions
+		where session_id = $1 and revoked_at is null and expires_at > now())`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var active bool
+	if err := s.DB.QueryRowContext(ctx, sql, sessionID).Scan(&active); err != nil {
+		return false, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return active, nil
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	errors_api "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Функция получения логина пользователя
+func (s *Store) UserLogin(ctx context.Context, userID int) (string, error) {
+	sqlString := `select user_name from ya.users where user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var login string
+	err := s.DB.QueryRowContext(ctx, sqlString, userID).Scan(&login)
+	if err == sql.ErrNoRows {
+		return "", errors_api.ErrorUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	return login, nil
+}
+
+// Экранирование спецсимволов шаблона like
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Функция получения списка пользователей, логин которых содержит query (без учёта регистра),
+// упорядоченного по ID
+func (s *Store) ListUsers(ctx context.Context, query string, limit, offset int) ([]models.UserDB, error) {
+	sqlString := `
+	select user_id, user_name, user_role, not coalesce(status, false), coalesce(blocked_reason, ''), blocked_at
+		from ya.users
+	where user_name ilike '%' || $1 || '%'
+	order by user_id
+	limit $2 offset $3`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, sqlString, likeEscaper.Replace(query), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	defer rows.Close()
+
+	res := make([]models.UserDB, 0)
+	for rows.Next() {
+		var user models.UserDB
+		var blockedAt sql.NullString
+		if err = rows.Scan(&user.ID, &user.Login, &user.Role, &user.Blocked, &user.BlockedReason, &blockedAt); err != nil {
+			return nil, fmt.Errorf("%s %w", errors_api.ErrorScanQuery.Error(), err)
+		}
+		user.BlockedAt = blockedAt.String
+		res = append(res, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s %w", errors_api.ErrorScanQuery.Error(), err)
+	}
+	return res, nil
+}
+
+// Функция блокировки пользователя с указанием причины,
+// сессии пользователя отзываются в той же транзакции
+func (s *Store) BlockUser(ctx context.Context, userID int, reason string) error {
+	sqlUser := `
+	update ya.users
+		set status = false, blocked_reason = $2, blocked_at = now()
+	where user_id = $1`
+	sqlSessions := `update ya.sessions set revoked_at = now() where user_id = $1 and revoked_at is null`
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorBeginTx.Error(), err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, sqlUser, userID, reason)
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if updated, err := res.RowsAffected(); err == nil && updated == 0 {
+		return errors_api.ErrorUserNotFound
+	}
+	if _, err = tx.ExecContext(ctx, sqlSessions, userID); err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecCommit.Error(), err)
+	}
+	return nil
+}
+
+// Функция снятия блокировки пользователя
+func (s *Store) UnblockUser(ctx context.Context, userID int) error {
+	return s.updateUser(ctx, `
+	update ya.users
+		set status = true, blocked_reason = null, blocked_at = null
+	where user_id = $1`, userID)
+}
+
+// Функция изменения пользователя, для неизвестного пользователя возвращает ErrorUserNotFound
+func (s *Store) updateUser(ctx context.Context, sqlString string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, sqlString, args...)
+	if err != nil {
+		return fmt.Errorf("%s %w", errors_api.ErrorExecQuery.Error(), err)
+	}
+	if updated, err := res.RowsAffected(); err == nil && updated == 0 {
+		return errors_api.ErrorUserNotFound
+	}
+	return nil
+}
@@ -23,6 +23,32 @@ var (
 	ErrorConflict = errors.New("informaion conflict")
 	// Ошибка, информация уже существует
 	ErrorInfoFound = errors.New("informaion already present (it's not error)")
+	// Ошибка, недостаточно средств на счёте
+	ErrorInsufficientFunds = errors.New("insufficient funds")
+	// Ошибка, сессия не найдена, истекла или отозвана
+	ErrorSessionInvalid = errors.New("session is invalid or revoked")
+	// Ошибка, текущий пароль пользователя указан неверно
+	ErrorWrongPassword = errors.New("current password is wrong")
+	// Ошибка, токен сброса пароля не найден, истёк или уже использован
+	ErrorResetInvalid = errors.New("password reset token is invalid or expired")
+	// Ошибка, пользователь не найден
+	ErrorUserNotFound = errors.New("user not found")
+	// Ошибка, пользователь заблокирован администратором
+	ErrorUserBlocked = errors.New("user is blocked")
+	// Ошибка, списание по заказу не найдено
+	ErrorWithdrawNotFound = errors.New("withdrawal not found")
+	// Ошибка, резерв баллов по заказу не найден
+	ErrorHoldNotFound = errors.New("hold not found")
+	// Ошибка, резерв уже подтверждён, отменён или истёк
+	ErrorHoldClosed = errors.New("hold is captured, released or expired")
+	// Ошибка проверки CSRF токена запроса, аутентифицированного cookie
+	ErrorCSRFToken = errors.New("csrf token is missing or invalid")
+	// Ошибка, у пользователя нет роли, необходимой для запроса
+	ErrorRoleRequired = errors.New("role is not allowed")
+	// Ошибка, сотрудник не может изменять собственную учётную запись
+	ErrorOwnAccount = errors.New("operation on own account is not allowed")
+	// Ошибка, ключ бэкенда магазина не передан или неизвестен
+	ErrorShopKey = errors.New("shop api key is missing or invalid")
 )
 
 type APIHandlerError struct {
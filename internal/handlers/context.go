@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+)
+
+// Аутентифицированный пользователь запроса
+type Principal struct {
+	// ID пользователя
+	UserID int
+	// Роли пользователя
+	Roles []string
+	// Идентификатор токена (jti)
+	TokenID string
+	// Идентификатор сессии
+	SessionID string
+}
+
+// Ключ пользователя в контексте запроса
+type principalKey struct{}
+
+// Функция добавления аутентифицированного пользователя в контекст
+func ContextWithUser(ctx context.Context, user Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, user)
+}
+
+// Функция получения аутентифицированного пользователя из контекста запроса,
+// возвращает false, если запрос не прошёл Authenticator
+func UserFromContext(ctx context.Context) (Principal, bool) {
+	user, ok := ctx.Value(principalKey{}).(Principal)
+	return user, ok && user.UserID != 0
+}
+
+// Функция проверки, что у пользователя есть хотя бы одна из ролей
+func (p Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if slices.Contains(p.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
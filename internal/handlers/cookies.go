@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+)
+
+// Имена cookie и заголовков с токенами
+const (
+	accessCookie  = "Authorization"
+	refreshCookie = "Refresh-Token"
+	// cookie с CSRF токеном доступна скриптам фронтенда
+	csrfCookie = "XSRF-TOKEN"
+	// заголовок, в котором фронтенд повторяет значение cookie CSRF токена
+	csrfHeader = "X-CSRF-Token"
+	// путь refresh cookie: токен передаётся только адресам пользователя
+	refreshPath = "/api/user"
+)
+
+// Параметры cookie аутентификации
+type CookieConfig struct {
+	// Путь cookie токена доступа и CSRF токена
+	Path string
+	// Домен cookie, по умолчанию домен сервера
+	Domain string
+	// Передавать cookie только по HTTPS
+	Secure bool
+	// Ограничение передачи cookie в межсайтовых запросах
+	SameSite http.SameSite
+}
+
+// Параметры cookie по умолчанию
+var DefaultCookieConfig = CookieConfig{
+	Path:     "/",
+	Secure:   true,
+	SameSite: http.SameSiteLaxMode,
+}
+
+// Функция установки параметров cookie аутентификации
+func WithCookies(cfg CookieConfig) Option {
+	return func(ah *APIHandler) {
+		if cfg.Path == "" {
+			cfg.Path = DefaultCookieConfig.Path
+		}
+		if cfg.SameSite == 0 {
+			cfg.SameSite = DefaultCookieConfig.SameSite
+		}
+		ah.cookies = cfg
+	}
+}
+
+// Функция разбора режима SameSite: lax, strict или none
+func ParseSameSite(mode string) (http.SameSite, error) {
+	switch strings.ToLower(mode) {
+	case "lax", "":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown SameSite mode %q", mode)
+	}
+}
+
+// Функция создания cookie с параметрами АПИ; отрицательное ttl удаляет cookie
+func (ah *APIHandler) cookie(name, value, path string, ttl time.Duration, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   ah.cookies.Domain,
+		Secure:   ah.cookies.Secure,
+		HttpOnly: httpOnly,
+		SameSite: ah.cookies.SameSite,
+	}
+	if ttl < 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.Expires = time.Now().Add(ttl)
+	}
+	return cookie
+}
+
+// Функция генерации CSRF токена
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Функция проверки CSRF токена методом double-submit: значение заголовка X-CSRF-Token
+// должно совпадать с cookie XSRF-TOKEN. Безопасные методы не проверяются
+func checkCSRF(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return nil
+	}
+
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return errorsapi.ErrorCSRFToken
+	}
+	header := r.Header.Get(csrfHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return errorsapi.ErrorCSRFToken
+	}
+	return nil
+}
+
+// Функция ответа 403 с причиной отказа
+func writeForbidden(w http.ResponseWriter, reason error) {
+	resp, _ := json.Marshal(ErrorResponse{Error: "forbidden", Reason: reason.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write(resp)
+}
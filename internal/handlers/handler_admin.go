@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// Функция получения пользователя из параметра {id} адреса запроса сотрудника.
+// Отвечает 400 на некорректный ID и 404 на неизвестного пользователя
+func (ah *APIHandler) targetUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || userID <= 0 {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "wrong user id")
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, false
+	}
+
+	if _, err = ah.db.UserRole(r.Context(), userID); err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		if errors.Is(err, errorsapi.ErrorUserNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return 0, false
+	}
+
+	staff, _ := UserFromContext(r.Context())
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("staff userID %d access userID %d", staff.UserID, userID))
+	return userID, true
+}
+
+//	@Summary		Get user orders
+//	@Description	get orders of any user, support and admin roles only
+//	@Produce		json
+//	@Param id path int true "User ID"
+//	@Success		200		{array}	Orders			"ok"
+//	@Failure		204		{string}	string	"No content"
+//	@Failure		403		{object}	ErrorResponse	"Role is not allowed"
+//	@Failure		404		{string}	string	"User not found"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/support/users/{id}/orders [get]
+//
+// Перечень заказов пользователя для сотрудника поддержки
+func (ah *APIHandler) SupportOrders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if userID, ok := ah.targetUser(w, r); ok {
+		ah.writeOrders(w, r, userID)
+	}
+}
+
+//	@Summary		Get user balance
+//	@Description	get balance of any user, support and admin roles only
+//	@Produce		json
+//	@Param id path int true "User ID"
+//	@Success		200		{object}	models.WithdrawDB			"ok"
+//	@Failure		403		{object}	ErrorResponse	"Role is not allowed"
+//	@Failure		404		{string}	string	"User not found"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/support/users/{id}/balance [get]
+//
+// Баланс пользователя для сотрудника поддержки
+func (ah *APIHandler) SupportBalance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if userID, ok := ah.targetUser(w, r); ok {
+		ah.writeBalance(w, r, userID)
+	}
+}
+
+//	@Summary		Get user history
+//	@Description	get accruals, withdrawals and adjustments of any user, support and admin roles only
+//	@Produce		json
+//	@Param id path int true "User ID"
+//	@Success		200		{array}	HistoryEntry			"ok"
+//	@Failure		204		{string}	string	"No content"
+//	@Failure		403		{object}	ErrorResponse	"Role is not allowed"
+//	@Failure		404		{string}	string	"User not found"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/support/users/{id}/history [get]
+//
+// История операций по счёту пользователя для сотрудника поддержки
+func (ah *APIHandler) SupportHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if userID, ok := ah.targetUser(w, r); ok {
+		ah.writeHistory(w, r, userID)
+	}
+}
+
+//	@Summary		Set user role
+//	@Description	assign role to user, admin role only; sessions of user are revoked
+//	@Accept		json
+//	@Param id path int true "User ID"
+//	@Param request body RoleRequest true "Role: user, support or admin"
+//	@Success		200		{string}	string			"ok"
+//	@Failure		400		{string}	string	"Bad request"
+//	@Failure		403		{object}	ErrorResponse	"Role is not allowed"
+//	@Failure		404		{string}	string	"User not found"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/admin/users/{id}/role [put]
+//
+// Назначение роли пользователю. Сессии пользователя отзываются,
+// чтобы новая роль сразу действовала во всех его токенах
+func (ah *APIHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := ah.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	req := &RoleRequest{}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil || !models.ValidRole(req.Role) {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "wrong role")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err = ah.db.SetUserRole(r.Context(), userID, req.Role); err != nil {
+		ah.writeUserError(w, r, err)
+		return
+	}
+	if err = ah.db.RevokeSessions(r.Context(), userID); err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d role %s", userID, req.Role))
+	w.WriteHeader(http.StatusOK)
+}
+
+// Параметры постраничного вывода пользователей
+const (
+	// Количество пользователей на странице по умолчанию
+	defaultUsersLimit = 50
+	// Максимальное количество пользователей на странице
+	maxUsersLimit = 500
+)
+
+//	@Summary		List users
+//	@Description	list and search users by login, admin role only
+//	@Produce		json
+//	@Param query query string false "Part of login"
+//	@Param limit query int false "Page size, 50 by default"
+//	@Param offset query int false "Page offset"
+//	@Success		200		{array}	User			"ok"
+//	@Failure		400		{string}	string	"Bad request"
+//	@Failure		403		{object}	ErrorResponse	"Role is not allowed"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/admin/users [get]
+//
+// Перечень и поиск пользователей по части логина
+func (ah *APIHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.URL.Query()
+	limit, offset := defaultUsersLimit, 0
+	var err error
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxUsersLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	users, err := ah.db.ListUsers(r.Context(), params.Get("query"), limit, offset)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body := make([]User, 0, len(users))
+	for _, u := range users {
+		body = append(body, User(u))
+	}
+	resp, err := json.Marshal(body)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("users - %d", len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+//	@Summary		Block user
+//	@Description	block user with reason and revoke sessions, admin role only
+//	@Accept		json
+//	@Param id path int true "User ID"
+//	@Param request body BlockRequest true "Block reason"
+//	@Success		200		{string}	string			"ok"
+//	@Failure		400		{string}	string	"Bad request"
+//	@Failure		403		{object}	ErrorResponse	"Role is not allowed"
+//	@Failure		404		{string}	string	"User not found"
+//	@Failure		409		{string}	string	"Admin can't block own account"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/admin/users/{id}/block [post]
+//
+// Блокировка пользователя, активные сессии пользователя отзываются
+func (ah *APIHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := ah.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if admin, _ := UserFromContext(r.Context()); admin.UserID == userID {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "admin can't block own account")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	req := &BlockRequest{}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil || strings.TrimSpace(req.Reason) == "" {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "block reason is empty")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err = ah.db.BlockUser(r.Context(), userID, req.Reason); err != nil {
+		ah.writeUserError(w, r, err)
+		return
+	}
+
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d blocked: %s", userID, req.Reason))
+	w.WriteHeader(http.StatusOK)
+}
+
+//	@Summary		Unblock user
+//	@Description	unblock user, admin role only
+//	@Param id path int true "User ID"
+//	@Success		200		{string}	string			"ok"
+//	@Failure		403		{object}	ErrorResponse	"Role is not allowed"
+//	@Failure		404		{string}	string	"User not found"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/admin/users/{id}/unblock [post]
+//
+// Снятие блокировки пользователя
+func (ah *APIHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := ah.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := ah.db.UnblockUser(r.Context(), userID); err != nil {
+		ah.writeUserError(w, r, err)
+		return
+	}
+
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d unblocked", userID))
+	w.WriteHeader(http.StatusOK)
+}
+
+//	@Summary		Adjust user balance
+//	@Description	credit (positive amount) or debit (negative amount) user balance with reason code, admin role only
+//	@Accept		json
+//	@Produce		json
+//	@Param id path int true "User ID"
+//	@Param request body AdjustmentRequest true "Signed amount, reason code: GOODWILL, FRAUD or CORRECTION"
+//	@Success		201		{object}	Adjustment			"Created"
+//	@Failure		400		{string}	string	"Bad request"
+//	@Failure		403		{object}	ErrorResponse	"Role is not allowed"
+//	@Failure		404		{string}	string	"User not found"
+//	@Failure		409		{object}	ErrorResponse	"Insufficient funds for GOODWILL or CORRECTION debit, or own account"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/admin/users/{id}/adjustments [post]
+//
+// Ручная корректировка баланса пользователя. Оператор, выполнивший корректировку,
+// сохраняется вместе с ней, корректировка собственного счёта запрещена.
+// Изъятие по коду FRAUD выполняется и при недостаточном остатке, остальные списания
+// сверх остатка завершаются ответом 409
+func (ah *APIHandler) AddAdjustment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID, ok := ah.targetUser(w, r)
+	if !ok {
+		return
+	}
+	operator, _ := UserFromContext(r.Context())
+	if operator.UserID == userID {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "operator can't adjust own balance")
+		writeConflict(w, errorsapi.ErrorOwnAccount)
+		return
+	}
+
+	req := &AdjustmentRequest{}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil || req.Amount == 0 || !models.ValidAdjustmentReason(req.ReasonCode) {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "wrong adjustment")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	adjustmentID, err := ah.db.AddAdjustment(r.Context(), userID, operator.UserID, req.Amount, req.ReasonCode, req.Comment)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		switch {
+		case errors.Is(err, errorsapi.ErrorInsufficientFunds) && !models.AdjustmentAllowsNegative(req.ReasonCode):
+			writeConflict(w, errorsapi.ErrorInsufficientFunds)
+		case errors.Is(err, errorsapi.ErrorUserNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, errorsapi.ErrorRegInfo):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	resp, _ := json.Marshal(Adjustment{
+		ID:         adjustmentID,
+		UserID:     userID,
+		OperatorID: operator.UserID,
+		Amount:     req.Amount,
+		ReasonCode: req.ReasonCode,
+		Comment:    req.Comment,
+	})
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description",
+		fmt.Sprintf("operator userID %d adjusted userID %d by %s: %s", operator.UserID, userID, req.Amount, req.ReasonCode))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+}
+
+//	@Summary		Reverse withdrawal
+//	@Description	reverse withdrawal by order number and restore points, admin role only
+//	@Accept		json
+//	@Produce		json
+//	@Param order path string true "Order number"
+//	@Param request body ReversalRequest false "Reversal reason"
+//	@Success		200		{object}	Withdraw			"Reversed or already reversed"
+//	@Failure		400		{string}	string	"Bad request"
+//	@Failure		403		{object}	ErrorResponse	"Role is not allowed"
+//	@Failure		404		{string}	string	"Withdrawal not found"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/admin/withdrawals/{order}/reverse [post]
+//
+// Отмена списания администратором, администратор сохраняется вместе с отметкой об отмене
+func (ah *APIHandler) AdminReverseWithdraw(w http.ResponseWriter, r *http.Request) {
+	admin, _ := UserFromContext(r.Context())
+	ah.reverseWithdraw(w, r, fmt.Sprintf("admin:%d", admin.UserID))
+}
+
+// Функция ответа 409 с причиной отказа
+func writeConflict(w http.ResponseWriter, reason error) {
+	resp, _ := json.Marshal(ErrorResponse{Error: "conflict", Reason: reason.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	w.Write(resp)
+}
+
+// Функция ответа на ошибку изменения пользователя
+func (ah *APIHandler) writeUserError(w http.ResponseWriter, r *http.Request, err error) {
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+	if errors.Is(err, errorsapi.ErrorUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
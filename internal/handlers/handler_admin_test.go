@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+func TestAPIHandler_Roles(t *testing.T) {
+	initAccrual()
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	src := memory.New()
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
+	router := ah.InitRouter()
+
+	do := func(method, url, body, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	register := func(login string) (string, int) {
+		t.Helper()
+		w := do(http.MethodPost, "/api/user/register", `{"login": "`+login+`", "password": "secret"}`, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("register %s status = %d", login, w.Code)
+		}
+		token := w.Header().Get("Authorization")
+		return token, tokenUserID(ah, token)
+	}
+	login := func(login string) string {
+		t.Helper()
+		return do(http.MethodPost, "/api/user/login", `{"login": "`+login+`", "password": "secret"}`, "").Header().Get("Authorization")
+	}
+
+	customer, customerID := register("customer")
+	_, supportID := register("support")
+	_, adminID := register("admin")
+	src.SetUserRole(context.Background(), supportID, models.RoleSupport)
+	src.SetUserRole(context.Background(), adminID, models.RoleAdmin)
+	support, admin := login("support"), login("admin")
+
+	if claims, err := ah.tokens.Parse(admin); err != nil || len(claims.Roles) != 1 || claims.Roles[0] != models.RoleAdmin {
+		t.Fatalf("admin token roles = %v, %v", claims, err)
+	}
+	if w := do(http.MethodPost, "/api/user/orders", "12345678903", customer); w.Code != http.StatusAccepted {
+		t.Fatalf("add order status = %d", w.Code)
+	}
+
+	orders := fmt.Sprintf("/api/support/users/%d/orders", customerID)
+	balance := fmt.Sprintf("/api/support/users/%d/balance", customerID)
+	role := fmt.Sprintf("/api/admin/users/%d/role", customerID)
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		token      string
+		statusCode int
+	}{
+		{name: "customer orders lookup", method: http.MethodGet, url: orders, token: customer, statusCode: http.StatusForbidden},
+		{name: "anonymous orders lookup", method: http.MethodGet, url: orders, statusCode: http.StatusUnauthorized},
+		{name: "support orders lookup", method: http.MethodGet, url: orders, token: support, statusCode: http.StatusOK},
+		{name: "support balance lookup", method: http.MethodGet, url: balance, token: support, statusCode: http.StatusOK},
+		{name: "admin balance lookup", method: http.MethodGet, url: balance, token: admin, statusCode: http.StatusOK},
+		{name: "unknown user lookup", method: http.MethodGet, url: "/api/support/users/1000/orders", token: support, statusCode: http.StatusNotFound},
+		{name: "wrong user id", method: http.MethodGet, url: "/api/support/users/abc/orders", token: support, statusCode: http.StatusBadRequest},
+		{name: "support sets role", method: http.MethodPut, url: role, body: `{"role": "admin"}`, token: support, statusCode: http.StatusForbidden},
+		{name: "admin sets unknown role", method: http.MethodPut, url: role, body: `{"role": "root"}`, token: admin, statusCode: http.StatusBadRequest},
+		{name: "admin sets role", method: http.MethodPut, url: role, body: `{"role": "support"}`, token: admin, statusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.method, tt.url, tt.body, tt.token)
+			if w.Code != tt.statusCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.statusCode)
+			}
+			if tt.statusCode == http.StatusForbidden {
+				resp := ErrorResponse{}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Reason != errorsapi.ErrorRoleRequired.Error() {
+					t.Errorf("body = %s, want reason %q", w.Body.String(), errorsapi.ErrorRoleRequired)
+				}
+			}
+		})
+	}
+
+	// смена роли отзывает сессии пользователя, новая сессия получает новую роль
+	if w := do(http.MethodGet, "/api/user/balance", "", customer); w.Code != http.StatusUnauthorized {
+		t.Errorf("session after role change status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := do(http.MethodGet, balance, "", login("customer")); w.Code != http.StatusOK {
+		t.Errorf("promoted user lookup status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAPIHandler_Users(t *testing.T) {
+	initAccrual()
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	src := memory.New()
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
+	router := ah.InitRouter()
+
+	do := func(method, url, body, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	login := func(login string) *httptest.ResponseRecorder {
+		t.Helper()
+		return do(http.MethodPost, "/api/user/login", `{"login": "`+login+`", "password": "secret"}`, "")
+	}
+
+	for _, name := range []string{"customer", "admin"} {
+		if w := do(http.MethodPost, "/api/user/register", `{"login": "`+name+`", "password": "secret"}`, ""); w.Code != http.StatusOK {
+			t.Fatalf("register %s status = %d", name, w.Code)
+		}
+	}
+	customer := login("customer").Header().Get("Authorization")
+	customerID := tokenUserID(ah, customer)
+	adminID := tokenUserID(ah, login("admin").Header().Get("Authorization"))
+	src.SetUserRole(context.Background(), adminID, models.RoleAdmin)
+	admin := login("admin").Header().Get("Authorization")
+
+	w := do(http.MethodGet, "/api/admin/users?query=cust&limit=10", "", admin)
+	users := []User{}
+	if err := json.Unmarshal(w.Body.Bytes(), &users); w.Code != http.StatusOK || err != nil || len(users) != 1 || users[0].ID != customerID {
+		t.Fatalf("list users = %d %s, want customer", w.Code, w.Body.String())
+	}
+
+	block := fmt.Sprintf("/api/admin/users/%d/block", customerID)
+	unblock := fmt.Sprintf("/api/admin/users/%d/unblock", customerID)
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		token      string
+		statusCode int
+	}{
+		{name: "customer lists users", method: http.MethodGet, url: "/api/admin/users", token: customer, statusCode: http.StatusForbidden},
+		{name: "wrong limit", method: http.MethodGet, url: "/api/admin/users?limit=abc", token: admin, statusCode: http.StatusBadRequest},
+		{name: "block without reason", method: http.MethodPost, url: block, body: `{}`, token: admin, statusCode: http.StatusBadRequest},
+		{name: "block self", method: http.MethodPost, url: fmt.Sprintf("/api/admin/users/%d/block", adminID), body: `{"reason": "test"}`, token: admin, statusCode: http.StatusConflict},
+		{name: "block unknown user", method: http.MethodPost, url: "/api/admin/users/1000/block", body: `{"reason": "test"}`, token: admin, statusCode: http.StatusNotFound},
+		{name: "block user", method: http.MethodPost, url: block, body: `{"reason": "fraud"}`, token: admin, statusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.url, tt.body, tt.token); w.Code != tt.statusCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.statusCode)
+			}
+		})
+	}
+
+	// блокировка отзывает сессии, вход возвращает явную причину отказа
+	if w := do(http.MethodGet, "/api/user/balance", "", customer); w.Code != http.StatusUnauthorized {
+		t.Errorf("blocked session status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w = login("customer")
+	resp := ErrorResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); w.Code != http.StatusForbidden || err != nil || resp.Reason != "user is blocked" {
+		t.Errorf("blocked login = %d %s, want %d", w.Code, w.Body.String(), http.StatusForbidden)
+	}
+	if w := do(http.MethodPost, "/api/user/login", `{"login": "customer", "password": "wrong"}`, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("blocked login with wrong password status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if w := do(http.MethodPost, unblock, "", admin); w.Code != http.StatusOK {
+		t.Fatalf("unblock status = %d", w.Code)
+	}
+	if w := login("customer"); w.Code != http.StatusOK {
+		t.Errorf("unblocked login status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAPIHandler_Adjustments(t *testing.T) {
+	initAccrual()
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	src := memory.New()
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
+	router := ah.InitRouter()
+
+	do := func(method, url, body, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	login := func(login string) string {
+		t.Helper()
+		return do(http.MethodPost, "/api/user/login", `{"login": "`+login+`", "password": "secret"}`, "").Header().Get("Authorization")
+	}
+
+	for _, name := range []string{"customer", "admin"} {
+		if w := do(http.MethodPost, "/api/user/register", `{"login": "`+name+`", "password": "secret"}`, ""); w.Code != http.StatusOK {
+			t.Fatalf("register %s status = %d", name, w.Code)
+		}
+	}
+	customer := login("customer")
+	customerID := tokenUserID(ah, customer)
+	adminID := tokenUserID(ah, login("admin"))
+	src.SetUserRole(context.Background(), adminID, models.RoleAdmin)
+	admin := login("admin")
+
+	if w := do(http.MethodGet, "/api/user/history", "", customer); w.Code != http.StatusNoContent {
+		t.Fatalf("empty history status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	adjustments := fmt.Sprintf("/api/admin/users/%d/adjustments", customerID)
+	tests := []struct {
+		name       string
+		url        string
+		body       string
+		token      string
+		statusCode int
+	}{
+		{name: "customer adjusts", url: adjustments, body: `{"amount": 10, "reason_code": "GOODWILL"}`, token: customer, statusCode: http.StatusForbidden},
+		{name: "zero amount", url: adjustments, body: `{"amount": 0, "reason_code": "GOODWILL"}`, token: admin, statusCode: http.StatusBadRequest},
+		{name: "unknown reason", url: adjustments, body: `{"amount": 10, "reason_code": "BONUS"}`, token: admin, statusCode: http.StatusBadRequest},
+		{name: "own account", url: fmt.Sprintf("/api/admin/users/%d/adjustments", adminID), body: `{"amount": 10, "reason_code": "GOODWILL"}`, token: admin, statusCode: http.StatusConflict},
+		{name: "unknown user", url: "/api/admin/users/1000/adjustments", body: `{"amount": 10, "reason_code": "GOODWILL"}`, token: admin, statusCode: http.StatusNotFound},
+		{name: "correction debit over balance", url: adjustments, body: `{"amount": -10, "reason_code": "CORRECTION"}`, token: admin, statusCode: http.StatusConflict},
+		{name: "goodwill credit", url: adjustments, body: `{"amount": 25.5, "reason_code": "GOODWILL", "comment": "late delivery"}`, token: admin, statusCode: http.StatusCreated},
+		{name: "goodwill debit over balance", url: adjustments, body: `{"amount": -30, "reason_code": "GOODWILL"}`, token: admin, statusCode: http.StatusConflict},
+		{name: "fraud debit", url: adjustments, body: `{"amount": -5, "reason_code": "FRAUD"}`, token: admin, statusCode: http.StatusCreated},
+		{name: "fraud clawback below zero", url: adjustments, body: `{"amount": -30, "reason_code": "FRAUD"}`, token: admin, statusCode: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(http.MethodPost, tt.url, tt.body, tt.token)
+			if w.Code != tt.statusCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.statusCode)
+			}
+			if tt.statusCode == http.StatusCreated {
+				resp := Adjustment{}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.ID == 0 || resp.OperatorID != adminID || resp.UserID != customerID {
+					t.Errorf("body = %s", w.Body.String())
+				}
+			}
+		})
+	}
+
+	// корректировки входят в баланс, но не в сумму списаний
+	w := do(http.MethodGet, "/api/user/balance", "", customer)
+	balance := models.WithdrawDB{}
+	if err := json.Unmarshal(w.Body.Bytes(), &balance); err != nil || balance.Current != -950 || balance.Withdrawn != 0 {
+		t.Errorf("balance = %s, want -9.5 / 0", w.Body.String())
+	}
+
+	w = do(http.MethodGet, "/api/user/history", "", customer)
+	history := []HistoryEntry{}
+	if err := json.Unmarshal(w.Body.Bytes(), &history); w.Code != http.StatusOK || err != nil || len(history) != 3 {
+		t.Fatalf("history = %d %s", w.Code, w.Body.String())
+	}
+	if history[0].Type != "ADJUSTMENT" || history[0].Amount != 2550 || history[0].ReasonCode != models.AdjustmentGoodwill ||
+		history[1].Amount != -500 || history[1].ReasonCode != models.AdjustmentFraud || history[2].Amount != -3000 {
+		t.Errorf("history = %s", w.Body.String())
+	}
+
+	if w := do(http.MethodGet, fmt.Sprintf("/api/support/users/%d/history", customerID), "", admin); w.Code != http.StatusOK {
+		t.Errorf("support history status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -6,12 +6,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
 
+	"github.com/closable/go-yandex-loyalty/internal/auth"
 	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
 	"github.com/closable/go-yandex-loyalty/internal/utils"
 	"github.com/closable/go-yandex-loyalty/models"
-	"go.uber.org/zap"
 )
 
 // Перечеь заказов пользователя
@@ -29,35 +28,18 @@ import (
 //	@Router			/api/user/orders [get]
 func (ah *APIHandler) Orders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	//userID := 6
-	userID, _ := strconv.Atoi(r.FormValue("userID"))
-
-	if userID == 0 {
-		token, _ := r.Cookie("Authorization")
-		headerAuth := r.Header.Get("Authorization")
-
-		if len(token.String()) > 0 {
-			userID = utils.GetUserID(token.Value)
-			w.Header().Add("Authorization", token.Value)
-			fmt.Printf("user get from existing cookies %d\n", userID)
-		}
-
-		if len(headerAuth) > 0 && userID == 0 {
-			userID = utils.GetUserID(headerAuth)
-			w.Header().Add("Authorization", headerAuth)
-			fmt.Printf("user get from existing header %d\n", userID)
-		}
-
-		fmt.Printf("user id %d\n", userID)
-	}
-
-	if userID == 0 {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "user unauthorized")
-		w.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(w, auth.ErrorTokenMissing)
 		return
 	}
+	ah.writeOrders(w, r, user.UserID)
+}
 
-	orders, err := ah.db.GetOrders(userID)
+// Функция ответа списком заказов пользователя
+func (ah *APIHandler) writeOrders(w http.ResponseWriter, r *http.Request, userID int) {
+	orders, err := ah.db.GetOrders(r.Context(), userID)
 	if err != nil {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -89,7 +71,7 @@ func (ah *APIHandler) Orders(w http.ResponseWriter, r *http.Request) {
 }
 
 // Вспомогательная функция для построения списка заказов
-func makeOrderItem(ordNumb, status string, accrual float32, uploadAt string) Orders {
+func makeOrderItem(ordNumb, status string, accrual models.Money, uploadAt string) Orders {
 	var res = &Orders{
 		Number:   ordNumb,
 		Status:   status,
@@ -110,43 +92,24 @@ func makeOrderItem(ordNumb, status string, accrual float32, uploadAt string) Ord
 // Запрос баланса
 func (ah *APIHandler) Balance(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	userID, _ := strconv.Atoi(r.FormValue("userID"))
-
-	if userID == 0 {
-		token, _ := r.Cookie("Authorization")
-		headerAuth := r.Header.Get("Authorization")
-
-		if len(token.String()) > 0 {
-			userID = utils.GetUserID(token.Value)
-			w.Header().Add("Authorization", token.Value)
-		}
-
-		if len(headerAuth) > 0 && userID == 0 {
-			userID = utils.GetUserID(headerAuth)
-			w.Header().Add("Authorization", headerAuth)
-		}
-		if userID != 0 {
-			ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "Restore authorization balance !")
-		}
-	}
-
-	if userID == 0 {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "user unauthorized")
-		w.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(w, auth.ErrorTokenMissing)
 		return
 	}
+	ah.writeBalance(w, r, user.UserID)
+}
 
-	current, withdraw, err := ah.db.Balance(userID)
+// Функция ответа балансом пользователя
+func (ah *APIHandler) writeBalance(w http.ResponseWriter, r *http.Request, userID int) {
+	body, err := ah.db.Balance(r.Context(), userID)
 	if err != nil {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	body := &models.WithdrawDB{
-		Current:   current - withdraw,
-		Withdrawn: withdraw,
-	}
 	resp, err := json.Marshal(body)
 	if err != nil {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
@@ -154,7 +117,7 @@ func (ah *APIHandler) Balance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d balance/withdraw - %f / %f", userID, current-withdraw, withdraw))
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d balance/withdraw/held - %s / %s / %s", userID, body.Current, body.Withdrawn, body.Held))
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(resp))
 }
@@ -174,29 +137,13 @@ func (ah *APIHandler) Balance(w http.ResponseWriter, r *http.Request) {
 func (ah *APIHandler) AddOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
 
-	userID, _ := strconv.Atoi(r.FormValue("userID"))
-
-	// check cookies I'm totaly disagree becaues headers set into middleware
-	if userID == 0 {
-		token, _ := r.Cookie("Authorization")
-		headerAuth := r.Header.Get("Authorization")
-
-		if len(token.String()) > 0 {
-			userID = utils.GetUserID(token.Value)
-			w.Header().Add("Authorization", token.Value)
-		}
-
-		if len(headerAuth) > 0 && userID == 0 {
-			userID = utils.GetUserID(headerAuth)
-			w.Header().Add("Authorization", headerAuth)
-		}
-	}
-
-	if userID == 0 {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "user unauthorized")
-		w.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(w, auth.ErrorTokenMissing)
 		return
 	}
+	userID := user.UserID
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil || len(body) == 0 {
@@ -212,22 +159,25 @@ func (ah *APIHandler) AddOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	acc, accStatus := AccrualActions(orderNumber, &ah.sugar, ah.accAddress)
-	if accStatus >= 400 {
+	acc, accStatus := ah.accrual.GetOrder(r.Context(), orderNumber)
+	if accStatus == http.StatusTooManyRequests {
+		// accrual ограничил запросы, заказ будет синхронизирован фоновым процессом
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("the accrual system is throttling, order %s accepted as new", orderNumber))
+	} else if accStatus >= 400 {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("the accrual system return wrong status %d", accStatus))
 		w.WriteHeader(accStatus)
 		return
 	}
 
 	status := "NEW"
-	var accrual float32 = 0.0
+	var accrual models.Money
 	// if accrual return the result else default
 	if accStatus < 204 {
 		status = acc.Status
 		accrual = acc.Accrual
 	}
 
-	err = ah.db.AddOrder(userID, orderNumber, status, accrual)
+	err = ah.db.AddOrder(r.Context(), userID, orderNumber, status, accrual)
 	if err != nil {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
 		if errors.Is(errorsapi.ErrorConflict, err) {
@@ -250,37 +200,22 @@ func (ah *APIHandler) AddOrder(w http.ResponseWriter, r *http.Request) {
 //	@Param data body  models.WithdrawGet true "Params"
 //	@Success		200		{string}	string			"ok"
 //	@Failure		201		{string}	string	"No content"
+//	@Failure		402		{string}	string	"Insufficient funds"
+//	@Failure		409		{string}	string	"Order already withdrawn"
+//	@Failure		422		{string}	string	"Wrong order number or sum"
 //	@Failure		500		{string}	string	"Internal server error"
 //	@Router			/api/user/balance/withdraw [post]
 //
 // Сохранение запроса списания баллов
 func (ah *APIHandler) GetWithdraw(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	userID, _ := strconv.Atoi(r.FormValue("userID"))
-
-	if userID == 0 {
-		token, _ := r.Cookie("Authorization")
-		headerAuth := r.Header.Get("Authorization")
-
-		if len(token.String()) > 0 {
-			userID = utils.GetUserID(token.Value)
-			w.Header().Add("Authorization", token.Value)
-		}
-
-		if len(headerAuth) > 0 && userID == 0 {
-			userID = utils.GetUserID(headerAuth)
-			w.Header().Add("Authorization", headerAuth)
-		}
-		if userID != 0 {
-			ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "Restore authorization getwithdraw !")
-		}
-	}
-
-	if userID == 0 {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "user unauthorized")
-		w.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(w, auth.ErrorTokenMissing)
 		return
 	}
+	userID := user.UserID
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil || len(body) == 0 {
@@ -301,28 +236,25 @@ func (ah *APIHandler) GetWithdraw(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusUnprocessableEntity)
 		return
 	}
-
-	current, withdrawn, err := ah.db.Balance(userID)
-	if err != nil {
-		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
-		w.WriteHeader(http.StatusInternalServerError)
-
-	}
-
-	// check balance
-	if current-withdrawn < req.Sum {
-		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("balance %f/ withdraw %f", current-withdrawn, req.Sum))
-		w.WriteHeader(http.StatusPaymentRequired)
+	if req.Sum <= 0 {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "error withdraw sum")
+		w.WriteHeader(http.StatusUnprocessableEntity)
 		return
 	}
 
-	err = ah.db.AddWithdraw(userID, req.Order, req.Sum)
+	err = ah.db.AddWithdraw(r.Context(), userID, req.Order, req.Sum)
 	if err != nil {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		if errors.Is(err, errorsapi.ErrorInsufficientFunds) {
+			w.WriteHeader(http.StatusPaymentRequired)
+		} else if errors.Is(err, errorsapi.ErrorConflict) {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		return
 	}
-	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d order %s withdrawn - %f", userID, req.Order, req.Sum))
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d order %s withdrawn - %s", userID, req.Order, req.Sum))
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -340,33 +272,15 @@ func (ah *APIHandler) GetWithdraw(w http.ResponseWriter, r *http.Request) {
 // Запрос всех списаний пользователя
 func (ah *APIHandler) Withdrawals(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	userID, _ := strconv.Atoi(r.FormValue("userID"))
-
-	if userID == 0 {
-		token, _ := r.Cookie("Authorization")
-		headerAuth := r.Header.Get("Authorization")
-
-		if len(token.String()) > 0 {
-			userID = utils.GetUserID(token.Value)
-			w.Header().Add("Authorization", token.Value)
-		}
-
-		if len(headerAuth) > 0 && userID == 0 {
-			userID = utils.GetUserID(headerAuth)
-			w.Header().Add("Authorization", headerAuth)
-		}
-		if userID != 0 {
-			ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "Restore authorization wihdrawals !")
-		}
-	}
-
-	if userID == 0 {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "user unauthorized")
-		w.WriteHeader(http.StatusUnauthorized)
+		writeUnauthorized(w, auth.ErrorTokenMissing)
 		return
 	}
+	userID := user.UserID
 
-	orders, err := ah.db.GetWithdrawals(userID)
+	orders, err := ah.db.GetWithdrawals(r.Context(), userID)
 	if err != nil {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -381,7 +295,7 @@ func (ah *APIHandler) Withdrawals(w http.ResponseWriter, r *http.Request) {
 
 	body := make([]Withdraw, 0)
 	for _, v := range orders {
-		row := makeWithdrawItem(v.Order, v.Sum, v.ProcessedAt)
+		row := makeWithdrawItem(v.Order, v.Sum, v.ProcessedAt, v.ReversedAt)
 		body = append(body, row)
 	}
 
@@ -397,51 +311,70 @@ func (ah *APIHandler) Withdrawals(w http.ResponseWriter, r *http.Request) {
 }
 
 // Вспомогательная функция для подготовки единицы списания
-func makeWithdrawItem(ordNumb string, sum float32, processedAt string) Withdraw {
+func makeWithdrawItem(ordNumb string, sum models.Money, processedAt, reversedAt string) Withdraw {
 	var res = &Withdraw{
 		Order:       ordNumb,
 		Sum:         sum,
 		ProcessedAt: processedAt,
+		ReversedAt:  reversedAt,
 	}
 	return *res
 }
 
-// Вспомогательная функция для синхронизации заказов между приложением и accrual системой
-func AccrualActions(orderNumber string, sugar *zap.SugaredLogger, accAddress string) (*models.AccrualGet, int) {
-
-	client := &http.Client{}
-	// check order into accrual
-	accrual := &models.AccrualGet{}
-
-	sugar.Infoln(fmt.Sprintf("getting info from accrual  %s/api/orders/%s", accAddress, orderNumber))
-	accOrder, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/orders/%s", accAddress, orderNumber), nil)
-	if err != nil {
-		sugar.Infoln("accrual actions: getting order info into the system", err)
-		return accrual, http.StatusInternalServerError
-	}
-	accOrder.Header.Set("Content-Type", "application/json")
-	accResp, err := client.Do(accOrder)
-	if err != err {
-		sugar.Infoln(fmt.Sprintf("accrual actions: invalid %v", err))
-		return accrual, http.StatusInternalServerError
-	}
-	if accResp.StatusCode > 202 {
-		sugar.Infoln(fmt.Sprintf("accrual actions: return order %s status %d", orderNumber, accResp.StatusCode))
-		return accrual, accResp.StatusCode
+//	@Summary		Get history
+//	@Description	get accruals, withdrawals and adjustments of current user
+//	@Produce		json
+//	@Success		200		{array}	HistoryEntry			"ok"
+//	@Failure		204		{string}	string	"No content"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/user/history [get]
+//
+// История операций по счёту пользователя
+func (ah *APIHandler) History(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "user unauthorized")
+		writeUnauthorized(w, auth.ErrorTokenMissing)
+		return
 	}
+	ah.writeHistory(w, r, user.UserID)
+}
 
-	body, err := io.ReadAll(accResp.Body)
+// Функция ответа историей операций по счёту пользователя
+func (ah *APIHandler) writeHistory(w http.ResponseWriter, r *http.Request, userID int) {
+	history, err := ah.db.GetHistory(r.Context(), userID)
 	if err != nil {
-		sugar.Infoln("accrual actions: read body", err)
-		return accrual, http.StatusInternalServerError
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
-	defer accResp.Body.Close()
 
-	if err = json.Unmarshal(body, accrual); err != nil {
-		sugar.Infoln("accrual actions: unpack body to json", err)
-		return accrual, http.StatusInternalServerError
+	if len(history) == 0 {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("no content userID %d", userID))
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
 
-	return accrual, accResp.StatusCode
+	body := make([]HistoryEntry, 0, len(history))
+	for _, v := range history {
+		body = append(body, HistoryEntry{
+			Type:       v.Type,
+			Reference:  v.Reference,
+			Amount:     v.Amount,
+			ReasonCode: v.Reason,
+			CreatedAt:  v.CreatedAt,
+		})
+	}
 
+	resp, err := json.Marshal(body)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d history - %d", userID, len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
 }
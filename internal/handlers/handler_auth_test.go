@@ -8,12 +8,13 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
-	"net/url"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/closable/go-yandex-loyalty/internal/config"
-	"github.com/closable/go-yandex-loyalty/internal/db"
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/internal/accrualmock"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
 	"github.com/closable/go-yandex-loyalty/internal/utils"
 )
 
@@ -22,26 +23,41 @@ type Balance struct {
 	Withdrawn float32 `json:"withdrawn"`
 }
 
-var dsn string
+// Адрес симулятора accrual системы, общий для тестов пакета
 var acc string
 
-func initDSN() {
-	if len(dsn) > 0 {
+// Функция добавления аутентифицированного пользователя в запрос, как это делает Authenticator
+func withUser(r *http.Request, userID int) *http.Request {
+	if userID == 0 {
+		return r
+	}
+	return r.WithContext(ContextWithUser(r.Context(), Principal{UserID: userID}))
+}
+
+// Функция получения ID пользователя из выданного токена
+func tokenUserID(ah *APIHandler, token string) int {
+	claims, err := ah.tokens.Parse(token)
+	if err != nil {
+		return 0
+	}
+	return claims.UserID
+}
+
+// Функция запуска симулятора accrual системы, заказы сразу получают статус PROCESSED
+func initAccrual() {
+	if len(acc) > 0 {
 		return
 	}
-	cfg := config.LoadConfig()
-	dsn = cfg.DSN
-	acc = cfg.AccrualAddress
+	mock := accrualmock.New(accrualmock.Options{Pipeline: []string{"PROCESSED"}})
+	acc = httptest.NewServer(mock.Handler()).URL
 }
 
 func TestAPIHandler_AddOrder(t *testing.T) {
-	if len(dsn) == 0 {
-		initDSN()
-	}
-	src, _ := db.NewDB(dsn)
+	initAccrual()
+	src := memory.New()
 	logger := NewLogger()
 	sugar := *logger.Sugar()
-	ah, _ := New(src, sugar, acc)
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
 	type wants struct {
 		body       string
 		statusCode int
@@ -171,10 +187,8 @@ func TestAPIHandler_AddOrder(t *testing.T) {
 		case 2:
 			ah.Login(w, r)
 		case 3:
-			if userID > 0 && tt.wants.step >= 2 {
-				values := url.Values{}
-				values.Add("userID", fmt.Sprintf("%d", userID))
-				r.PostForm = values
+			if tt.wants.step >= 2 {
+				r = withUser(r, userID)
 			}
 			if tt.wants.statusCode < 300 {
 				// before needs add goods & order into accruals
@@ -188,7 +202,7 @@ func TestAPIHandler_AddOrder(t *testing.T) {
 		if tt.wants.authAction && tt.wants.step == 2 && w.Code == http.StatusOK {
 			headerAuth := w.Header().Get("Authorization")
 			// set user ID from header
-			userID = utils.GetUserID(headerAuth)
+			userID = tokenUserID(ah, headerAuth)
 		}
 
 		if tt.wants.statusCode != w.Code {
@@ -199,13 +213,11 @@ func TestAPIHandler_AddOrder(t *testing.T) {
 }
 
 func TestAPIHandler_Orders(t *testing.T) {
-	if len(dsn) == 0 {
-		initDSN()
-	}
-	src, _ := db.NewDB(dsn)
+	initAccrual()
+	src := memory.New()
 	logger := NewLogger()
 	sugar := *logger.Sugar()
-	ah, _ := New(src, sugar, acc)
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
 	type wants struct {
 		body       string
 		statusCode int
@@ -339,18 +351,14 @@ func TestAPIHandler_Orders(t *testing.T) {
 		case 2:
 			ah.Login(w, r)
 		case 3:
-			values := url.Values{}
-			values.Add("userID", fmt.Sprintf("%d", userID))
-			r.PostForm = values
+			r = withUser(r, userID)
 			if tt.wants.statusCode < 300 {
 				addAcrualTestData(acc, tt.wants.body)
 			}
 
 			ah.AddOrder(w, r)
 		case 4:
-			values := url.Values{}
-			values.Add("userID", fmt.Sprintf("%d", userID))
-			r.PostForm = values
+			r = withUser(r, userID)
 
 			ah.Orders(w, r)
 			if w.Code == http.StatusOK {
@@ -366,7 +374,7 @@ func TestAPIHandler_Orders(t *testing.T) {
 		if tt.wants.authAction && tt.wants.step == 2 && w.Code == http.StatusOK {
 			headerAuth := w.Header().Get("Authorization")
 			// set user ID from header
-			userID = utils.GetUserID(headerAuth)
+			userID = tokenUserID(ah, headerAuth)
 		}
 
 		if tt.wants.statusCode != w.Code {
@@ -380,13 +388,11 @@ func TestAPIHandler_Orders(t *testing.T) {
 }
 
 func TestAPIHandler_Balance(t *testing.T) {
-	if len(dsn) == 0 {
-		initDSN()
-	}
-	src, _ := db.NewDB(dsn)
+	initAccrual()
+	src := memory.New()
 	logger := NewLogger()
 	sugar := *logger.Sugar()
-	ah, _ := New(src, sugar, acc)
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
 	type wants struct {
 		body       string
 		statusCode int
@@ -520,17 +526,13 @@ func TestAPIHandler_Balance(t *testing.T) {
 		case 2:
 			ah.Login(w, r)
 		case 3:
-			values := url.Values{}
-			values.Add("userID", fmt.Sprintf("%d", userID))
-			r.PostForm = values
+			r = withUser(r, userID)
 			if tt.wants.statusCode < 300 {
 				addAcrualTestData(acc, tt.wants.body)
 			}
 			ah.AddOrder(w, r)
 		case 4:
-			values := url.Values{}
-			values.Add("userID", fmt.Sprintf("%d", userID))
-			r.PostForm = values
+			r = withUser(r, userID)
 
 			ah.Balance(w, r)
 			fmt.Println("!!!!", userID, w.Code, tt.wants.url, tt.name, tt.wants.statusCode)
@@ -548,7 +550,7 @@ func TestAPIHandler_Balance(t *testing.T) {
 			if w.Code == http.StatusOK {
 				headerAuth := w.Header().Get("Authorization")
 				// set user ID from header
-				userID = utils.GetUserID(headerAuth)
+				userID = tokenUserID(ah, headerAuth)
 			} else {
 				userID = 0
 			}
@@ -562,13 +564,11 @@ func TestAPIHandler_Balance(t *testing.T) {
 }
 
 func TestAPIHandler_Withdrawals(t *testing.T) {
-	if len(dsn) == 0 {
-		initDSN()
-	}
-	src, _ := db.NewDB(dsn)
+	initAccrual()
+	src := memory.New()
 	logger := NewLogger()
 	sugar := *logger.Sugar()
-	ah, _ := New(src, sugar, acc)
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
 	type wants struct {
 		body       string
 		statusCode int
@@ -634,6 +634,30 @@ func TestAPIHandler_Withdrawals(t *testing.T) {
 				cnt:        0,
 			},
 		},
+		{
+			name: "Get withdraw with zero sum",
+			wants: wants{
+				body:       fmt.Sprintf(`{"order": "%s", "sum": 0}`, orderTest),
+				method:     "POST",
+				url:        "/api/user/balance/withdraw",
+				statusCode: http.StatusUnprocessableEntity,
+				authAction: false,
+				step:       5,
+				cnt:        0,
+			},
+		},
+		{
+			name: "Get withdraw with negative sum",
+			wants: wants{
+				body:       fmt.Sprintf(`{"order": "%s", "sum": -100}`, orderTest),
+				method:     "POST",
+				url:        "/api/user/balance/withdraw",
+				statusCode: http.StatusUnprocessableEntity,
+				authAction: false,
+				step:       5,
+				cnt:        0,
+			},
+		},
 		{
 			name: "Get withdraw",
 			wants: wants{
@@ -676,17 +700,13 @@ func TestAPIHandler_Withdrawals(t *testing.T) {
 		case 2:
 			ah.Login(w, r)
 		case 3:
-			values := url.Values{}
-			values.Add("userID", fmt.Sprintf("%d", userID))
-			r.PostForm = values
+			r = withUser(r, userID)
 			if tt.wants.statusCode < 300 {
 				addAcrualTestData(acc, tt.wants.body)
 			}
 			ah.AddOrder(w, r)
 		case 4:
-			values := url.Values{}
-			values.Add("userID", fmt.Sprintf("%d", userID))
-			r.PostForm = values
+			r = withUser(r, userID)
 			ah.Withdrawals(w, r)
 			if w.Code == http.StatusOK {
 				body, _ := io.ReadAll(w.Body)
@@ -697,9 +717,7 @@ func TestAPIHandler_Withdrawals(t *testing.T) {
 			}
 
 		case 5:
-			values := url.Values{}
-			values.Add("userID", fmt.Sprintf("%d", userID))
-			r.PostForm = values
+			r = withUser(r, userID)
 			ah.GetWithdraw(w, r)
 
 		}
@@ -708,7 +726,7 @@ func TestAPIHandler_Withdrawals(t *testing.T) {
 			if w.Code == http.StatusOK {
 				headerAuth := w.Header().Get("Authorization")
 				// set user ID from header
-				userID = utils.GetUserID(headerAuth)
+				userID = tokenUserID(ah, headerAuth)
 			} else {
 				userID = 0
 			}
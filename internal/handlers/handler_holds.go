@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/auth"
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/internal/utils"
+	"github.com/closable/go-yandex-loyalty/models"
+	"github.com/go-chi/chi/v5"
+)
+
+//	@Summary		Hold points
+//	@Description	reserve points for order while payment is pending, held points are not available for other withdrawals
+//	@Accept		json
+//	@Produce		json
+//	@Param request body HoldRequest true "Order number and sum"
+//	@Success		201		{object}	Hold			"Created"
+//	@Failure		400		{string}	string	"Bad request"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		402		{string}	string	"Insufficient funds"
+//	@Failure		409		{string}	string	"Order is already held or withdrawn"
+//	@Failure		422		{string}	string	"Wrong order number"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/user/balance/holds [post]
+//
+// Резервирование баллов под списание по заказу на время оплаты
+func (ah *APIHandler) CreateHold(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		writeUnauthorized(w, auth.ErrorTokenMissing)
+		return
+	}
+
+	req := &HoldRequest{}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil || req.Sum <= 0 {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "err body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if ok := utils.CheckOrderByLuna(req.Order); !ok || len(req.Order) > models.MaxOrderNumberLen {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "error order number")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	hold, err := ah.db.CreateHold(r.Context(), user.UserID, req.Order, req.Sum, time.Now().Add(ah.holdTTL))
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		switch {
+		case errors.Is(err, errorsapi.ErrorInsufficientFunds):
+			w.WriteHeader(http.StatusPaymentRequired)
+		case errors.Is(err, errorsapi.ErrorConflict):
+			w.WriteHeader(http.StatusConflict)
+		case errors.Is(err, errorsapi.ErrorRegInfo):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	resp, _ := json.Marshal(makeHold(hold))
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d order %s held - %s", user.UserID, req.Order, req.Sum))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+}
+
+//	@Summary		Capture hold
+//	@Description	withdraw points held for order
+//	@Produce		json
+//	@Param order path string true "Order number"
+//	@Success		200		{object}	Hold			"Captured or already captured"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		404		{string}	string	"Hold not found"
+//	@Failure		409		{object}	ErrorResponse	"Hold is released or expired"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/user/balance/holds/{order}/capture [post]
+//
+// Подтверждение резерва пользователем
+func (ah *APIHandler) CaptureHold(w http.ResponseWriter, r *http.Request) {
+	if user, ok := UserFromContext(r.Context()); ok {
+		ah.closeHold(w, r, user.UserID, ah.db.CaptureHold)
+		return
+	}
+	writeUnauthorized(w, auth.ErrorTokenMissing)
+}
+
+//	@Summary		Release hold
+//	@Description	release points held for order
+//	@Produce		json
+//	@Param order path string true "Order number"
+//	@Success		200		{object}	Hold			"Released, expired or already released"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		404		{string}	string	"Hold not found"
+//	@Failure		409		{object}	ErrorResponse	"Hold is captured"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/user/balance/holds/{order}/release [post]
+//
+// Отмена резерва пользователем
+func (ah *APIHandler) ReleaseHold(w http.ResponseWriter, r *http.Request) {
+	if user, ok := UserFromContext(r.Context()); ok {
+		ah.closeHold(w, r, user.UserID, ah.db.ReleaseHold)
+		return
+	}
+	writeUnauthorized(w, auth.ErrorTokenMissing)
+}
+
+//	@Summary		Capture hold by shop
+//	@Description	withdraw points held for paid order, trusted shop backend only
+//	@Produce		json
+//	@Param order path string true "Order number"
+//	@Param X-Shop-Key header string true "Shop backend API key"
+//	@Success		200		{object}	Hold			"Captured or already captured"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		404		{string}	string	"Hold not found"
+//	@Failure		409		{object}	ErrorResponse	"Hold is released or expired"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/shop/holds/{order}/capture [post]
+//
+// Подтверждение резерва бэкендом магазина после оплаты заказа
+func (ah *APIHandler) ShopCaptureHold(w http.ResponseWriter, r *http.Request) {
+	ah.closeHold(w, r, 0, ah.db.CaptureHold)
+}
+
+//	@Summary		Release hold by shop
+//	@Description	release points held for cancelled order, trusted shop backend only
+//	@Produce		json
+//	@Param order path string true "Order number"
+//	@Param X-Shop-Key header string true "Shop backend API key"
+//	@Success		200		{object}	Hold			"Released, expired or already released"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		404		{string}	string	"Hold not found"
+//	@Failure		409		{object}	ErrorResponse	"Hold is captured"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/shop/holds/{order}/release [post]
+//
+// Отмена резерва бэкендом магазина при отмене оплаты
+func (ah *APIHandler) ShopReleaseHold(w http.ResponseWriter, r *http.Request) {
+	ah.closeHold(w, r, 0, ah.db.ReleaseHold)
+}
+
+// Функция завершения резерва по номеру заказа из адреса запроса операцией op.
+// Повторное завершение той же операцией не изменяет баланс и завершается ответом 200
+func (ah *APIHandler) closeHold(w http.ResponseWriter, r *http.Request, userID int,
+	op func(ctx context.Context, userID int, orderNumber string) (models.HoldDB, error)) {
+	w.Header().Set("Content-Type", "application/json")
+	order := chi.URLParam(r, "order")
+
+	hold, err := op(r.Context(), userID, order)
+	switch {
+	case err == nil, errors.Is(err, errorsapi.ErrorInfoFound):
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("hold %s %s", order, hold.Status))
+	case errors.Is(err, errorsapi.ErrorHoldNotFound):
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case errors.Is(err, errorsapi.ErrorHoldClosed), errors.Is(err, errorsapi.ErrorConflict):
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		writeConflict(w, err)
+		return
+	default:
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp, _ := json.Marshal(makeHold(hold))
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// Вспомогательная функция для подготовки резерва
+func makeHold(hold models.HoldDB) Hold {
+	return Hold{
+		Order:     hold.Order,
+		Sum:       hold.Sum,
+		Status:    hold.Status,
+		CreatedAt: hold.CreatedAt,
+		ExpiresAt: hold.ExpiresAt,
+	}
+}
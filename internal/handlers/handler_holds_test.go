@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+func TestAPIHandler_Holds(t *testing.T) {
+	initAccrual()
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	src := memory.New()
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar), WithShopKeys("shop-key"), WithHoldTTL(time.Minute))
+	router := ah.InitRouter()
+
+	do := func(method, url, body string, header map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	users := make(map[string]string)
+	for _, name := range []string{"customer", "other"} {
+		w := do(http.MethodPost, "/api/user/register", `{"login": "`+name+`", "password": "secret"}`, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("register %s status = %d", name, w.Code)
+		}
+		users[name] = w.Header().Get("Authorization")
+	}
+	customer := map[string]string{"Authorization": users["customer"]}
+	other := map[string]string{"Authorization": users["other"]}
+	shop := map[string]string{"X-Shop-Key": "shop-key"}
+	src.AddOrder(context.Background(), tokenUserID(ah, users["customer"]), "12345678903", "PROCESSED", 50000)
+
+	tests := []struct {
+		name       string
+		url        string
+		body       string
+		header     map[string]string
+		statusCode int
+		status     string
+	}{
+		{name: "anonymous hold", url: "/api/user/balance/holds", body: `{"order": "2377225624", "sum": 100}`, statusCode: http.StatusUnauthorized},
+		{name: "zero sum", url: "/api/user/balance/holds", body: `{"order": "2377225624", "sum": 0}`, header: customer, statusCode: http.StatusBadRequest},
+		{name: "wrong order", url: "/api/user/balance/holds", body: `{"order": "2377225625", "sum": 100}`, header: customer, statusCode: http.StatusUnprocessableEntity},
+		{name: "too long order", url: "/api/user/balance/holds", body: `{"order": "123456789012345678906", "sum": 100}`, header: customer, statusCode: http.StatusUnprocessableEntity},
+		{name: "insufficient funds", url: "/api/user/balance/holds", body: `{"order": "2377225624", "sum": 501}`, header: customer, statusCode: http.StatusPaymentRequired},
+		{name: "hold for shop", url: "/api/user/balance/holds", body: `{"order": "2377225624", "sum": 200}`, header: customer, statusCode: http.StatusCreated, status: models.HoldHeld},
+		{name: "hold for release", url: "/api/user/balance/holds", body: `{"order": "79927398713", "sum": 100}`, header: customer, statusCode: http.StatusCreated, status: models.HoldHeld},
+		{name: "hold same order", url: "/api/user/balance/holds", body: `{"order": "2377225624", "sum": 1}`, header: customer, statusCode: http.StatusConflict},
+		{name: "withdraw over available", url: "/api/user/balance/withdraw", body: `{"order": "4561261212345467", "sum": 201}`, header: customer, statusCode: http.StatusPaymentRequired},
+		{name: "shop without key", url: "/api/shop/holds/2377225624/capture", statusCode: http.StatusUnauthorized},
+		{name: "shop captures", url: "/api/shop/holds/2377225624/capture", header: shop, statusCode: http.StatusOK, status: models.HoldCaptured},
+		{name: "shop captures again", url: "/api/shop/holds/2377225624/capture", header: shop, statusCode: http.StatusOK, status: models.HoldCaptured},
+		{name: "shop releases captured", url: "/api/shop/holds/2377225624/release", header: shop, statusCode: http.StatusConflict},
+		{name: "other user releases", url: "/api/user/balance/holds/79927398713/release", header: other, statusCode: http.StatusNotFound},
+		{name: "user releases", url: "/api/user/balance/holds/79927398713/release", header: customer, statusCode: http.StatusOK, status: models.HoldReleased},
+		{name: "user captures released", url: "/api/user/balance/holds/79927398713/capture", header: customer, statusCode: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(http.MethodPost, tt.url, tt.body, tt.header)
+			if w.Code != tt.statusCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.statusCode)
+			}
+			if tt.status != "" {
+				resp := Hold{}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Status != tt.status || resp.ExpiresAt == "" {
+					t.Errorf("body = %s, want status %s", w.Body.String(), tt.status)
+				}
+			}
+		})
+	}
+
+	if w := do(http.MethodPost, "/api/user/balance/holds", `{"order": "4561261212345467", "sum": 50}`, customer); w.Code != http.StatusCreated {
+		t.Fatalf("hold status = %d", w.Code)
+	}
+	w := do(http.MethodGet, "/api/user/balance", "", customer)
+	balance := models.WithdrawDB{}
+	if err := json.Unmarshal(w.Body.Bytes(), &balance); err != nil || balance.Current != 25000 || balance.Withdrawn != 20000 || balance.Held != 5000 {
+		t.Errorf("balance = %s, want 250 / 200 / 50", w.Body.String())
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/auth"
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+)
+
+//	@Summary		Change password
+//	@Description	Change password of current user, other sessions are revoked
+//	@ID ChangePassword
+//	@Accept		json
+//	@Produce		json
+//	@Param request body PasswordChangeRequest true "Current and new password"
+//	@Success		200		{object}	TokenResponse			"ok"
+//	@Failure		400		{string}	string	"Bad request"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		403		{object}	ErrorResponse	"Current password is wrong"
+//	@Failure		409		{string}	string	"Password changed concurrently"
+//	@Failure		429		{object}	ErrorResponse	"Too many failed attempts"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/user/password [post]
+//
+// Смена пароля пользователя.
+// Неверный текущий пароль учитывается в счётчиках неудачных попыток входа.
+// Все сессии пользователя отзываются, текущий клиент получает токены новой сессии
+func (ah *APIHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		writeUnauthorized(w, auth.ErrorTokenMissing)
+		return
+	}
+
+	req := &PasswordChangeRequest{}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil || req.NewPassword == "" {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "err body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	login, err := ah.db.UserLogin(r.Context(), user.UserID)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ip := ah.clientIP(r)
+	until, err := ah.db.LoginLockedUntil(r.Context(), login, ip)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if time.Now().Before(until) {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("password change of %s from %s is locked until %s", login, ip, until))
+		writeTooManyAttempts(w, until)
+		return
+	}
+
+	if err = ah.db.ChangePassword(r.Context(), user.UserID, req.CurrentPassword, req.NewPassword); err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		switch {
+		case errors.Is(err, errorsapi.ErrorWrongPassword):
+			until, err = ah.db.AddLoginFailure(r.Context(), login, ip, ah.lockout)
+			if err != nil {
+				ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if time.Now().Before(until) {
+				w.Header().Set("Retry-After", retryAfter(until))
+			}
+			writeForbidden(w, errorsapi.ErrorWrongPassword)
+		case errors.Is(err, errorsapi.ErrorRegInfo):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, errorsapi.ErrorConflict):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	if err = ah.db.ResetLoginFailures(r.Context(), login); err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+	}
+
+	if err = ah.db.RevokeSessions(r.Context(), user.UserID); err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	tokens, err := ah.startSession(r.Context(), w, user.UserID)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp, _ := json.Marshal(tokens)
+
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d password changed", user.UserID))
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+//	@Summary		Request password reset
+//	@Description	Send password reset token to user
+//	@ID RequestPasswordReset
+//	@Accept		json
+//	@Param request body PasswordResetRequest true "User login"
+//	@Success		202		{string}	string			"Accepted"
+//	@Failure		400		{string}	string	"Bad request"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/user/password/reset/request [post]
+//
+// Запрос токена сброса пароля.
+// Ответ не зависит от существования пользователя, чтобы не раскрывать зарегистрированные логины.
+// Запросы учитываются в счётчиках неудачных попыток входа по логину и IP адресу,
+// во время задержки или блокировки токен не создаётся и уведомление не отправляется
+func (ah *APIHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	req := &PasswordResetRequest{}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil || req.Login == "" {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "err body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ip := ah.clientIP(r)
+	until, err := ah.db.LoginLockedUntil(r.Context(), req.Login, ip)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if time.Now().Before(until) {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("password reset of %s from %s is throttled until %s", req.Login, ip, until))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if _, err = ah.db.AddLoginFailure(r.Context(), req.Login, ip, ah.lockout); err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	token, hash, err := auth.NewResetToken()
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().Add(ah.resetTTL)
+	userID, err := ah.db.CreatePasswordReset(r.Context(), req.Login, hash, expiresAt)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if userID != 0 {
+		if err = ah.notifier.PasswordReset(r.Context(), req.Login, token, expiresAt); err != nil {
+			ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		}
+	}
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("password reset requested for %s", req.Login))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+//	@Summary		Confirm password reset
+//	@Description	Set new password by reset token, all sessions are revoked
+//	@ID ConfirmPasswordReset
+//	@Accept		json
+//	@Produce		json
+//	@Param request body PasswordResetConfirm true "Reset token and new password"
+//	@Success		200		{string}	string			"ok"
+//	@Failure		400		{object}	ErrorResponse	"Bad request or invalid token"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/user/password/reset/confirm [post]
+//
+// Установка нового пароля по токену сброса
+func (ah *APIHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	req := &PasswordResetConfirm{}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil || req.Token == "" || req.NewPassword == "" {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "err body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	userID, err := ah.db.ResetPassword(r.Context(), auth.HashResetToken(req.Token), req.NewPassword)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		switch {
+		case errors.Is(err, errorsapi.ErrorResetInvalid):
+			writeBadRequest(w, err)
+		case errors.Is(err, errorsapi.ErrorRegInfo):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err = ah.db.RevokeSessions(r.Context(), userID); err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d password reset", userID))
+	w.WriteHeader(http.StatusOK)
+}
+
+// Функция ответа 400 с причиной отказа
+func writeBadRequest(w http.ResponseWriter, reason error) {
+	resp, _ := json.Marshal(ErrorResponse{Error: "bad_request", Reason: reason.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(resp)
+}
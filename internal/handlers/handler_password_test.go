@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/internal/lockout"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
+)
+
+// Уведомления, сохраняющие последний токен сброса пароля
+type resetNotifier struct {
+	login, token string
+}
+
+func (n *resetNotifier) PasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error {
+	n.login, n.token = login, token
+	return nil
+}
+
+func TestAPIHandler_Password(t *testing.T) {
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	notifier := &resetNotifier{}
+	ah, _ := New(memory.New(), sugar, accrual.New("", time.Second, 1, &sugar), WithNotifier(notifier))
+	router := ah.InitRouter()
+
+	do := func(method, url, body, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	login := func(pass string) string {
+		t.Helper()
+		w := do(http.MethodPost, "/api/user/login", `{"login": "password", "password": "`+pass+`"}`, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("login with %s status = %d", pass, w.Code)
+		}
+		return w.Header().Get("Authorization")
+	}
+
+	if w := do(http.MethodPost, "/api/user/register", `{"login": "password", "password": "secret"}`, ""); w.Code != http.StatusOK {
+		t.Fatalf("register status = %d", w.Code)
+	}
+	current, other := login("secret"), login("secret")
+
+	// смена пароля требует текущий пароль
+	if w := do(http.MethodPost, "/api/user/password", `{"current_password": "wrong", "new_password": "changed"}`, current); w.Code != http.StatusForbidden {
+		t.Errorf("change with wrong password status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := do(http.MethodPost, "/api/user/password", `{"current_password": "secret"}`, current); w.Code != http.StatusBadRequest {
+		t.Errorf("change without new password status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	w := do(http.MethodPost, "/api/user/password", `{"current_password": "secret", "new_password": "changed"}`, current)
+	if w.Code != http.StatusOK {
+		t.Fatalf("change status = %d", w.Code)
+	}
+	tokens := TokenResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil || tokens.AccessToken == "" {
+		t.Fatalf("change body = %s", w.Body.String())
+	}
+	for name, token := range map[string]string{"current": current, "other": other} {
+		if w := do(http.MethodGet, "/api/user/balance", "", token); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s session after change status = %d, want %d", name, w.Code, http.StatusUnauthorized)
+		}
+	}
+	if w := do(http.MethodGet, "/api/user/balance", "", tokens.AccessToken); w.Code != http.StatusOK {
+		t.Errorf("new session after change status = %d, want %d", w.Code, http.StatusOK)
+	}
+	session := login("changed")
+
+	// сброс пароля для неизвестного логина не отличается от известного
+	if w := do(http.MethodPost, "/api/user/password/reset/request", `{"login": "unknown"}`, ""); w.Code != http.StatusAccepted || notifier.token != "" {
+		t.Fatalf("reset request of unknown login status = %d, token %q", w.Code, notifier.token)
+	}
+	if w := do(http.MethodPost, "/api/user/password/reset/request", `{"login": "password"}`, ""); w.Code != http.StatusAccepted || notifier.login != "password" || notifier.token == "" {
+		t.Fatalf("reset request status = %d, notified %q %q", w.Code, notifier.login, notifier.token)
+	}
+
+	if w := do(http.MethodPost, "/api/user/password/reset/confirm", `{"token": "guess", "new_password": "reset"}`, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("confirm with wrong token status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	confirm := `{"token": "` + notifier.token + `", "new_password": "reset"}`
+	if w := do(http.MethodPost, "/api/user/password/reset/confirm", confirm, ""); w.Code != http.StatusOK {
+		t.Fatalf("confirm status = %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/api/user/password/reset/confirm", confirm, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("confirm with used token status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := do(http.MethodGet, "/api/user/balance", "", session); w.Code != http.StatusUnauthorized {
+		t.Errorf("session after reset status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	login("reset")
+}
+
+func TestAPIHandler_ChangePasswordLockout(t *testing.T) {
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	ah, _ := New(memory.New(), sugar, accrual.New("", time.Second, 1, &sugar), WithLoginPolicy(lockout.Policy{
+		Login:  lockout.Rule{Free: 2, Threshold: 2, Lockout: time.Minute},
+		IP:     lockout.Rule{Threshold: 100, Lockout: time.Minute},
+		Window: time.Minute,
+	}))
+	router := ah.InitRouter()
+
+	do := func(url, body, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("/api/user/register", `{"login": "guess", "password": "secret"}`, ""); w.Code != http.StatusOK {
+		t.Fatalf("register status = %d", w.Code)
+	}
+	token := do("/api/user/login", `{"login": "guess", "password": "secret"}`, "").Header().Get("Authorization")
+
+	wrong := `{"current_password": "wrong", "new_password": "changed"}`
+	if w := do("/api/user/password", wrong, token); w.Code != http.StatusForbidden || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("first failure status = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := do("/api/user/password", wrong, token); w.Code != http.StatusForbidden || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("locking failure status = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// перебор текущего пароля блокирует и смену пароля, и вход по логину
+	if w := do("/api/user/password", `{"current_password": "secret", "new_password": "changed"}`, token); w.Code != http.StatusTooManyRequests {
+		t.Errorf("locked change status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w := do("/api/user/login", `{"login": "guess", "password": "secret"}`, ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("login after locked change status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestAPIHandler_PasswordResetThrottle(t *testing.T) {
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	notifier := &resetNotifier{}
+	ah, _ := New(memory.New(), sugar, accrual.New("", time.Second, 1, &sugar), WithNotifier(notifier), WithLoginPolicy(lockout.Policy{
+		Login:  lockout.Rule{Free: 2, Threshold: 2, Lockout: time.Minute},
+		IP:     lockout.Rule{Threshold: 100, Lockout: time.Minute},
+		Window: time.Minute,
+	}))
+	router := ah.InitRouter()
+
+	do := func(url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("/api/user/register", `{"login": "flood", "password": "secret"}`); w.Code != http.StatusOK {
+		t.Fatalf("register status = %d", w.Code)
+	}
+	for i := 0; i < 2; i++ {
+		notifier.token = ""
+		if w := do("/api/user/password/reset/request", `{"login": "flood"}`); w.Code != http.StatusAccepted || notifier.token == "" {
+			t.Fatalf("reset request %d status = %d, token %q", i, w.Code, notifier.token)
+		}
+	}
+
+	// во время блокировки ответ не меняется, но уведомление не отправляется
+	notifier.token = ""
+	if w := do("/api/user/password/reset/request", `{"login": "flood"}`); w.Code != http.StatusAccepted || notifier.token != "" {
+		t.Errorf("throttled reset request status = %d, token %q", w.Code, notifier.token)
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/auth"
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+)
+
+// Функция создания сессии пользователя и выдачи её токенов
+func (ah *APIHandler) startSession(ctx context.Context, w http.ResponseWriter, userID int) (TokenResponse, error) {
+	sessionID, err := auth.NewSessionID()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	refresh, hash, err := auth.NewRefreshToken(sessionID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if err = ah.db.CreateSession(ctx, userID, sessionID, hash, time.Now().Add(ah.tokens.RefreshTTL())); err != nil {
+		return TokenResponse{}, err
+	}
+
+	return ah.issueTokens(ctx, w, userID, sessionID, refresh)
+}
+
+// Функция выпуска токена доступа с текущей ролью пользователя и передачи токенов сессии
+// в заголовках и cookie. Вместе с cookie выдаётся CSRF токен, который фронтенд повторяет
+// в заголовке X-CSRF-Token
+func (ah *APIHandler) issueTokens(ctx context.Context, w http.ResponseWriter, userID int, sessionID, refresh string) (TokenResponse, error) {
+	role, err := ah.db.UserRole(ctx, userID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	access, err := ah.tokens.Build(userID, sessionID, role)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	csrf, err := newCSRFToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	w.Header().Add("Authorization", access)
+	w.Header().Add(refreshCookie, refresh)
+	w.Header().Set(csrfHeader, csrf)
+	http.SetCookie(w, ah.cookie(accessCookie, access, ah.cookies.Path, ah.tokens.TTL(), true))
+	http.SetCookie(w, ah.cookie(refreshCookie, refresh, refreshPath, ah.tokens.RefreshTTL(), true))
+	http.SetCookie(w, ah.cookie(csrfCookie, csrf, ah.cookies.Path, ah.tokens.RefreshTTL(), false))
+
+	return TokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(ah.tokens.TTL().Seconds()),
+	}, nil
+}
+
+// Функция удаления cookie с токенами сессии
+func (ah *APIHandler) clearTokens(w http.ResponseWriter) {
+	http.SetCookie(w, ah.cookie(accessCookie, "", ah.cookies.Path, -1, true))
+	http.SetCookie(w, ah.cookie(refreshCookie, "", refreshPath, -1, true))
+	http.SetCookie(w, ah.cookie(csrfCookie, "", ah.cookies.Path, -1, false))
+}
+
+// Функция получения refresh токена запроса: тело запроса, cookie или заголовок.
+// Признак fromCookie означает, что токен передан браузером и запрос требует проверки CSRF
+func refreshToken(r *http.Request) (token string, fromCookie bool) {
+	body, err := io.ReadAll(r.Body)
+	if err == nil && len(body) > 0 {
+		req := &RefreshRequest{}
+		if err = json.Unmarshal(body, req); err == nil && req.RefreshToken != "" {
+			return req.RefreshToken, false
+		}
+	}
+	if header := r.Header.Get(refreshCookie); header != "" {
+		return header, false
+	}
+	if cookie, err := r.Cookie(refreshCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, true
+	}
+	return "", false
+}
+
+//	@Summary		Refresh tokens
+//	@Description	Rotate refresh token and issue new access token
+//	@ID RefreshToken
+//	@Accept		json
+//	@Produce		json
+//	@Param request body RefreshRequest false "Refresh token, header or cookie Refresh-Token is used if empty"
+//	@Success		200		{object}	TokenResponse			"ok"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		403		{object}	ErrorResponse	"CSRF token is missing or invalid"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/user/token/refresh [post]
+//
+// Обновление токенов сессии
+func (ah *APIHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, fromCookie := refreshToken(r)
+	if fromCookie {
+		if err := checkCSRF(r); err != nil {
+			ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+			writeForbidden(w, err)
+			return
+		}
+	}
+
+	sessionID, hash, err := auth.ParseRefreshToken(token)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		writeUnauthorized(w, err)
+		return
+	}
+
+	refresh, newHash, err := auth.NewRefreshToken(sessionID)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := ah.db.RotateSession(r.Context(), sessionID, hash, newHash, time.Now().Add(ah.tokens.RefreshTTL()))
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		if errors.Is(err, errorsapi.ErrorSessionInvalid) {
+			ah.clearTokens(w)
+			writeUnauthorized(w, auth.ErrorSessionRevoked)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tokens, err := ah.issueTokens(r.Context(), w, userID, sessionID, refresh)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp, _ := json.Marshal(tokens)
+
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d session %s refreshed", userID, sessionID))
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+//	@Summary		Logout
+//	@Description	Revoke current session
+//	@ID Logout
+//	@Success		200		{string}	string			"ok"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/user/logout [post]
+//
+// Завершение текущей сессии
+func (ah *APIHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		writeUnauthorized(w, auth.ErrorTokenMissing)
+		return
+	}
+
+	if err := ah.db.RevokeSession(r.Context(), user.UserID, user.SessionID); err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ah.clearTokens(w)
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d session %s revoked", user.UserID, user.SessionID))
+	w.WriteHeader(http.StatusOK)
+}
+
+//	@Summary		Logout everywhere
+//	@Description	Revoke all sessions of user
+//	@ID LogoutAll
+//	@Success		200		{string}	string			"ok"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/user/logout-all [post]
+//
+// Завершение всех сессий пользователя
+func (ah *APIHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		writeUnauthorized(w, auth.ErrorTokenMissing)
+		return
+	}
+
+	if err := ah.db.RevokeSessions(r.Context(), user.UserID); err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ah.clearTokens(w)
+	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("userID %d all sessions revoked", user.UserID))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
+)
+
+func TestAPIHandler_Sessions(t *testing.T) {
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	ah, _ := New(memory.New(), sugar, accrual.New("", time.Second, 1, &sugar))
+	router := ah.InitRouter()
+
+	do := func(method, url, body string, headers map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	refresh := func(token string) *httptest.ResponseRecorder {
+		t.Helper()
+		return do(http.MethodPost, "/api/user/token/refresh", `{"refresh_token": "`+token+`"}`, nil)
+	}
+
+	login := func() (string, string) {
+		t.Helper()
+		w := do(http.MethodPost, "/api/user/login", `{"login": "sessions", "password": "secret"}`, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("login status = %d", w.Code)
+		}
+		return w.Header().Get("Authorization"), w.Header().Get(refreshCookie)
+	}
+
+	if w := do(http.MethodPost, "/api/user/register", `{"login": "sessions", "password": "secret"}`, nil); w.Code != http.StatusOK {
+		t.Fatalf("register status = %d", w.Code)
+	}
+	access, refreshToken := login()
+	if access == "" || refreshToken == "" {
+		t.Fatalf("login tokens = %q, %q", access, refreshToken)
+	}
+
+	// ротация refresh токена
+	w := refresh(refreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh status = %d", w.Code)
+	}
+	tokens := TokenResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil || tokens.RefreshToken == refreshToken || tokens.AccessToken == "" {
+		t.Fatalf("refresh body = %s", w.Body.String())
+	}
+	if w = do(http.MethodGet, "/api/user/balance", "", map[string]string{"Authorization": tokens.AccessToken}); w.Code != http.StatusOK {
+		t.Errorf("balance with refreshed token status = %d", w.Code)
+	}
+
+	// повторное предъявление использованного токена отзывает сессию
+	if w = refresh(refreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused refresh status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w = refresh(tokens.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh of revoked session status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w = do(http.MethodGet, "/api/user/balance", "", map[string]string{"Authorization": tokens.AccessToken}); w.Code != http.StatusUnauthorized {
+		t.Errorf("balance of revoked session status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// выход из текущей сессии не затрагивает другие
+	first, _ := login()
+	second, secondRefresh := login()
+	if w = do(http.MethodPost, "/api/user/logout", "", map[string]string{"Authorization": first}); w.Code != http.StatusOK {
+		t.Fatalf("logout status = %d", w.Code)
+	}
+	if w = do(http.MethodGet, "/api/user/balance", "", map[string]string{"Authorization": first}); w.Code != http.StatusUnauthorized {
+		t.Errorf("balance after logout status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w = do(http.MethodGet, "/api/user/balance", "", map[string]string{"Authorization": second}); w.Code != http.StatusOK {
+		t.Errorf("balance of other session status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// выход из всех сессий
+	if w = do(http.MethodPost, "/api/user/logout-all", "", map[string]string{"Authorization": second}); w.Code != http.StatusOK {
+		t.Fatalf("logout-all status = %d", w.Code)
+	}
+	if w = do(http.MethodGet, "/api/user/balance", "", map[string]string{"Authorization": second}); w.Code != http.StatusUnauthorized {
+		t.Errorf("balance after logout-all status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w = refresh(secondRefresh); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout-all status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w = refresh("malformed"); w.Code != http.StatusUnauthorized {
+		t.Errorf("malformed refresh status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/go-chi/chi/v5"
+)
+
+// Заголовок с ключом доверенного бэкенда магазина
+const shopKeyHeader = "X-Shop-Key"
+
+// Функция установки ключей доверенного бэкенда магазина. Несколько ключей позволяют
+// выполнить ротацию без простоя, без ключей маршруты магазина недоступны
+func WithShopKeys(keys ...string) Option {
+	return func(ah *APIHandler) {
+		for _, key := range keys {
+			if key == "" {
+				continue
+			}
+			hash := sha256.Sum256([]byte(key))
+			ah.shopKeys = append(ah.shopKeys, hash[:])
+		}
+	}
+}
+
+// Middleware для аутентификации доверенного бэкенда магазина по ключу в заголовке X-Shop-Key.
+// Запрос с отсутствующим или неизвестным ключом завершается ответом 401
+func (ah *APIHandler) ShopAuthenticator(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ah.validShopKey(r.Header.Get(shopKeyHeader)) {
+			ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", errorsapi.ErrorShopKey)
+			writeUnauthorized(w, errorsapi.ErrorShopKey)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Функция проверки ключа магазина, сравниваются хэши ключей за постоянное время
+func (ah *APIHandler) validShopKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	hash := sha256.Sum256([]byte(key))
+	valid := 0
+	for _, known := range ah.shopKeys {
+		valid |= subtle.ConstantTimeCompare(hash[:], known)
+	}
+	return valid == 1
+}
+
+//	@Summary		Reverse withdrawal by shop
+//	@Description	reverse withdrawal of cancelled order and restore points, trusted shop backend only
+//	@Accept		json
+//	@Produce		json
+//	@Param order path string true "Order number"
+//	@Param X-Shop-Key header string true "Shop backend API key"
+//	@Param request body ReversalRequest false "Reversal reason"
+//	@Success		200		{object}	Withdraw			"Reversed or already reversed"
+//	@Failure		400		{string}	string	"Bad request"
+//	@Failure		401		{object}	ErrorResponse	"Unauthorized"
+//	@Failure		404		{string}	string	"Withdrawal not found"
+//	@Failure		500		{string}	string	"Internal server error"
+//	@Router			/api/shop/withdrawals/{order}/reverse [post]
+//
+// Отмена списания бэкендом магазина при отмене заказа
+func (ah *APIHandler) ShopReverseWithdraw(w http.ResponseWriter, r *http.Request) {
+	ah.reverseWithdraw(w, r, "shop")
+}
+
+// Функция отмены списания по номеру заказа из адреса запроса, reversedBy сохраняется
+// вместе с отметкой об отмене. Повторная отмена не изменяет баланс и завершается ответом 200
+func (ah *APIHandler) reverseWithdraw(w http.ResponseWriter, r *http.Request, reversedBy string) {
+	w.Header().Set("Content-Type", "application/json")
+	order := chi.URLParam(r, "order")
+
+	req := &ReversalRequest{}
+	body, err := io.ReadAll(r.Body)
+	if err == nil && len(body) > 0 {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil || order == "" {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", "err body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	withdraw, err := ah.db.ReverseWithdraw(r.Context(), order, reversedBy, req.Reason)
+	switch {
+	case errors.Is(err, errorsapi.ErrorInfoFound):
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("withdrawal %s already reversed", order))
+	case errors.Is(err, errorsapi.ErrorWithdrawNotFound):
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case err != nil:
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	default:
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description",
+			fmt.Sprintf("withdrawal %s reversed by %s, sum %s", order, reversedBy, withdraw.Sum))
+	}
+
+	resp, _ := json.Marshal(makeWithdrawItem(withdraw.Order, withdraw.Sum, withdraw.ProcessedAt, withdraw.ReversedAt))
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+func TestAPIHandler_ReverseWithdraw(t *testing.T) {
+	initAccrual()
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	src := memory.New()
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar), WithShopKeys("old-key", "", "shop-key"))
+	router := ah.InitRouter()
+
+	do := func(url, body string, header map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	login := func(login string) string {
+		t.Helper()
+		return do("/api/user/login", `{"login": "`+login+`", "password": "secret"}`, nil).Header().Get("Authorization")
+	}
+
+	for _, name := range []string{"customer", "admin"} {
+		if w := do("/api/user/register", `{"login": "`+name+`", "password": "secret"}`, nil); w.Code != http.StatusOK {
+			t.Fatalf("register %s status = %d", name, w.Code)
+		}
+	}
+	customer := login("customer")
+	customerID := tokenUserID(ah, customer)
+	src.SetUserRole(context.Background(), tokenUserID(ah, login("admin")), models.RoleAdmin)
+	admin := login("admin")
+
+	ctx := context.Background()
+	src.AddOrder(ctx, customerID, "12345678903", "PROCESSED", 50000)
+	for _, order := range []string{"2377225624", "79927398713"} {
+		if err := src.AddWithdraw(ctx, customerID, order, 10000); err != nil {
+			t.Fatalf("AddWithdraw() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		body       string
+		header     map[string]string
+		statusCode int
+	}{
+		{name: "shop without key", url: "/api/shop/withdrawals/2377225624/reverse", statusCode: http.StatusUnauthorized},
+		{name: "shop with wrong key", url: "/api/shop/withdrawals/2377225624/reverse", header: map[string]string{"X-Shop-Key": "wrong"}, statusCode: http.StatusUnauthorized},
+		{name: "customer as shop", url: "/api/shop/withdrawals/2377225624/reverse", header: map[string]string{"Authorization": customer}, statusCode: http.StatusUnauthorized},
+		{name: "shop unknown order", url: "/api/shop/withdrawals/4561261212345467/reverse", header: map[string]string{"X-Shop-Key": "shop-key"}, statusCode: http.StatusNotFound},
+		{name: "shop wrong body", url: "/api/shop/withdrawals/2377225624/reverse", body: "{", header: map[string]string{"X-Shop-Key": "shop-key"}, statusCode: http.StatusBadRequest},
+		{name: "shop reverses", url: "/api/shop/withdrawals/2377225624/reverse", body: `{"reason": "order cancelled"}`, header: map[string]string{"X-Shop-Key": "shop-key"}, statusCode: http.StatusOK},
+		{name: "shop retries with old key", url: "/api/shop/withdrawals/2377225624/reverse", header: map[string]string{"X-Shop-Key": "old-key"}, statusCode: http.StatusOK},
+		{name: "customer as admin", url: "/api/admin/withdrawals/79927398713/reverse", header: map[string]string{"Authorization": customer}, statusCode: http.StatusForbidden},
+		{name: "admin reverses", url: "/api/admin/withdrawals/79927398713/reverse", header: map[string]string{"Authorization": admin}, statusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.url, tt.body, tt.header)
+			if w.Code != tt.statusCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.statusCode)
+			}
+			if tt.statusCode == http.StatusOK {
+				resp := Withdraw{}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Sum != 10000 || resp.ReversedAt == "" {
+					t.Errorf("body = %s", w.Body.String())
+				}
+			}
+		})
+	}
+
+	// баллы возвращены один раз по каждому списанию
+	balance, _ := src.Balance(ctx, customerID)
+	if balance.Current != 50000 || balance.Withdrawn != 0 {
+		t.Errorf("balance = %s / %s, want 500 / 0", balance.Current, balance.Withdrawn)
+	}
+}
+
+func TestAPIHandler_ShopRoutesWithoutKeys(t *testing.T) {
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	ah, _ := New(memory.New(), sugar, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shop/withdrawals/2377225624/reverse", nil)
+	r.Header.Set("X-Shop-Key", "")
+	w := httptest.NewRecorder()
+	ah.InitRouter().ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
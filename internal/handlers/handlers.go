@@ -2,47 +2,119 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/internal/auth"
 	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
-	"github.com/closable/go-yandex-loyalty/internal/utils"
+	"github.com/closable/go-yandex-loyalty/internal/lockout"
+	"github.com/closable/go-yandex-loyalty/internal/notify"
 	"github.com/closable/go-yandex-loyalty/models"
 	"go.uber.org/zap"
 )
 
-// Интерфейс для реализации функционала
+// Интерфейс для реализации функционала, все операции прерываются при отмене ctx
 type Sourcer interface {
 	// Валидация данных пользователя
-	ValidateRegisterInfo(login, pass string) error
+	ValidateRegisterInfo(ctx context.Context, login, pass string) error
 	// Добавление пользователя
-	AddUser(login, pass string) error
+	AddUser(ctx context.Context, login, pass string) error
 	// утентификация пользователя
-	Login(login, pass string) (int, error)
+	Login(ctx context.Context, login, pass string) (int, error)
 	// Перечеь заказов пользователя
-	GetOrders(userID int) ([]models.OrdersDB, error)
-	// Баланс
-	Balance(userID int) (float32, float32, error)
+	GetOrders(ctx context.Context, userID int) ([]models.OrdersDB, error)
+	// Баланс: текущий остаток, сумма списаний и зарезервированные баллы
+	Balance(ctx context.Context, userID int) (models.WithdrawDB, error)
 	// Добавление заказа
-	AddOrder(userID int, orderNumber, accStatus string, accrual float32) error
-	// Добавление списания доступных баллов/рублей
-	AddWithdraw(userID int, orderNumber string, sum float32) error
+	AddOrder(ctx context.Context, userID int, orderNumber, accStatus string, accrual models.Money) error
+	// Добавление списания доступных баллов/рублей с проверкой остатка
+	AddWithdraw(ctx context.Context, userID int, orderNumber string, sum models.Money) error
 	// Перечент всех списаний
-	GetWithdrawals(userID int) ([]models.WithdrawGetDB, error)
-	// Подготовка первичного состояния системы хранения данных
-	PrepareDB() error
+	GetWithdrawals(ctx context.Context, userID int) ([]models.WithdrawGetDB, error)
+	// Создание сессии пользователя с хэшем refresh токена
+	CreateSession(ctx context.Context, userID int, sessionID, refreshHash string, expiresAt time.Time) error
+	// Замена refresh токена сессии, возвращает ID пользователя.
+	// Предъявление устаревшего токена отзывает сессию
+	RotateSession(ctx context.Context, sessionID, refreshHash, newHash string, expiresAt time.Time) (int, error)
+	// Отзыв сессии пользователя
+	RevokeSession(ctx context.Context, userID int, sessionID string) error
+	// Отзыв всех сессий пользователя
+	RevokeSessions(ctx context.Context, userID int) error
+	// Проверка, что сессия не отозвана и не истекла
+	SessionActive(ctx context.Context, sessionID string) (bool, error)
+	// Время, до которого вход по логину или с IP адреса запрещён
+	LoginLockedUntil(ctx context.Context, login, ip string) (time.Time, error)
+	// Учёт неудачной попытки входа, возвращает время, до которого следующая попытка запрещена
+	AddLoginFailure(ctx context.Context, login, ip string, policy lockout.Policy) (time.Time, error)
+	// Сброс счётчика неудачных попыток входа по логину
+	ResetLoginFailures(ctx context.Context, login string) error
+	// Смена пароля пользователя после проверки текущего пароля
+	ChangePassword(ctx context.Context, userID int, current, next string) error
+	// Сохранение хэша токена сброса пароля, для неизвестного пользователя возвращает 0
+	CreatePasswordReset(ctx context.Context, login, tokenHash string, expiresAt time.Time) (int, error)
+	// Установка нового пароля по одноразовому токену сброса, возвращает ID пользователя
+	ResetPassword(ctx context.Context, tokenHash, pass string) (int, error)
+	// Логин пользователя
+	UserLogin(ctx context.Context, userID int) (string, error)
+	// Роль пользователя
+	UserRole(ctx context.Context, userID int) (string, error)
+	// Назначение роли пользователю
+	SetUserRole(ctx context.Context, userID int, role string) error
+	// Перечень пользователей, логин которых содержит query
+	ListUsers(ctx context.Context, query string, limit, offset int) ([]models.UserDB, error)
+	// Блокировка пользователя с указанием причины и отзывом всех его сессий
+	BlockUser(ctx context.Context, userID int, reason string) error
+	// Снятие блокировки пользователя
+	UnblockUser(ctx context.Context, userID int) error
+	// Ручная корректировка баланса пользователя оператором, возвращает ID корректировки
+	AddAdjustment(ctx context.Context, userID, operatorID int, amount models.Money, reason, comment string) (int64, error)
+	// История операций по счёту пользователя
+	GetHistory(ctx context.Context, userID int) ([]models.HistoryDB, error)
+	// Отмена списания по номеру заказа с возвратом баллов.
+	// Для уже отменённого списания возвращает его и ErrorInfoFound
+	ReverseWithdraw(ctx context.Context, orderNumber, reversedBy, reason string) (models.WithdrawGetDB, error)
+	// Резервирование баллов под списание по заказу до expiresAt
+	CreateHold(ctx context.Context, userID int, orderNumber string, sum models.Money, expiresAt time.Time) (models.HoldDB, error)
+	// Подтверждение резерва списанием, userID 0 — резерв любого пользователя.
+	// Для уже подтверждённого резерва возвращает его и ErrorInfoFound
+	CaptureHold(ctx context.Context, userID int, orderNumber string) (models.HoldDB, error)
+	// Отмена резерва, userID 0 — резерв любого пользователя.
+	// Для уже отменённого или истёкшего резерва возвращает его и ErrorInfoFound
+	ReleaseHold(ctx context.Context, userID int, orderNumber string) (models.HoldDB, error)
 }
 
+// Время действия токена сброса пароля по умолчанию
+const DefaultPasswordResetTTL = time.Hour
+
+// Время действия резерва баллов по умолчанию
+const DefaultHoldTTL = time.Minute * 15
+
 type (
 	// Структура АПИ
 	APIHandler struct {
-		db         Sourcer
-		sugar      zap.SugaredLogger
-		accAddress string
+		db      Sourcer
+		sugar   zap.SugaredLogger
+		accrual *accrual.Client
+		tokens  *auth.Tokens
+		cookies CookieConfig
+		lockout lockout.Policy
+		// доверять заголовкам X-Real-IP и X-Forwarded-For обратного прокси
+		trustProxy bool
+		notifier   notify.Notifier
+		resetTTL   time.Duration
+		// SHA-256 хэши ключей доверенного бэкенда магазина
+		shopKeys [][]byte
+		holdTTL  time.Duration
 	}
 	// Запрос регистрации
 	RegisterRequest struct {
@@ -51,42 +123,192 @@ type (
 	}
 	// Номер заказа
 	Orders struct {
-		Number   string  `json:"number"`
-		Status   string  `json:"status"`
-		Accrual  float32 `json:"accrual"`
-		UploadAt string  `json:"upload_at"`
+		Number   string       `json:"number"`
+		Status   string       `json:"status"`
+		Accrual  models.Money `json:"accrual"`
+		UploadAt string       `json:"upload_at"`
 	}
 	// Запрос списания
 	WithdrawGet struct {
-		Order string  `json:"order"`
-		Sum   float32 `json:"sum"`
+		Order string       `json:"order"`
+		Sum   models.Money `json:"sum"`
 	}
 	// Единица списания баллов
 	Withdraw struct {
-		Order       string  `json:"order"`
-		Sum         float32 `json:"sum"`
-		ProcessedAt string  `json:"processed_at"`
+		Order       string       `json:"order"`
+		Sum         models.Money `json:"sum"`
+		ProcessedAt string       `json:"processed_at"`
+		ReversedAt  string       `json:"reversed_at,omitempty"`
+	}
+	// Запрос обновления токенов
+	RefreshRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	// Выпущенные токены сессии
+	TokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	// Запрос смены пароля
+	PasswordChangeRequest struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	// Запрос токена сброса пароля
+	PasswordResetRequest struct {
+		Login string `json:"login"`
+	}
+	// Запрос установки пароля по токену сброса
+	PasswordResetConfirm struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	// Запрос назначения роли
+	RoleRequest struct {
+		Role string `json:"role"`
+	}
+	// Запрос блокировки пользователя
+	BlockRequest struct {
+		Reason string `json:"reason"`
+	}
+	// Пользователь для администрирования
+	User struct {
+		ID            int    `json:"id"`
+		Login         string `json:"login"`
+		Role          string `json:"role"`
+		Blocked       bool   `json:"blocked"`
+		BlockedReason string `json:"blocked_reason,omitempty"`
+		BlockedAt     string `json:"blocked_at,omitempty"`
+	}
+	// Запрос ручной корректировки баланса
+	AdjustmentRequest struct {
+		Amount     models.Money `json:"amount"`
+		ReasonCode string       `json:"reason_code"`
+		Comment    string       `json:"comment"`
+	}
+	// Выполненная корректировка баланса
+	Adjustment struct {
+		ID         int64        `json:"id"`
+		UserID     int          `json:"user_id"`
+		OperatorID int          `json:"operator_id"`
+		Amount     models.Money `json:"amount"`
+		ReasonCode string       `json:"reason_code"`
+		Comment    string       `json:"comment,omitempty"`
+	}
+	// Запись истории операций по счёту
+	HistoryEntry struct {
+		Type       string       `json:"type"`
+		Reference  string       `json:"reference"`
+		Amount     models.Money `json:"amount"`
+		ReasonCode string       `json:"reason_code,omitempty"`
+		CreatedAt  string       `json:"created_at"`
+	}
+	// Запрос резервирования баллов
+	HoldRequest struct {
+		Order string       `json:"order"`
+		Sum   models.Money `json:"sum"`
+	}
+	// Резерв баллов под списание
+	Hold struct {
+		Order     string       `json:"order"`
+		Sum       models.Money `json:"sum"`
+		Status    string       `json:"status"`
+		CreatedAt string       `json:"created_at"`
+		ExpiresAt string       `json:"expires_at"`
+	}
+	// Запрос отмены списания
+	ReversalRequest struct {
+		Reason string `json:"reason"`
+	}
+	// Описание ошибки запроса
+	ErrorResponse struct {
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
 	}
 )
 
-// Подготовка СУБД и создание экземпляра хранения
-func New(src Sourcer, sugar zap.SugaredLogger, accAddress string) (*APIHandler, error) {
-	// prepare db
-	err := src.PrepareDB()
-	if err != nil {
-		sugar.Infoln("can't create DB set")
-		return &APIHandler{
-			db:         src,
-			sugar:      sugar,
-			accAddress: accAddress,
-		}, errors.New("SQL Server problem")
-	}
-
-	return &APIHandler{
-		db:         src,
-		sugar:      sugar,
-		accAddress: accAddress,
-	}, nil
+// Параметр АПИ
+type Option func(ah *APIHandler)
+
+// Функция установки выпуска и проверки токенов пользователей
+func WithTokens(tokens *auth.Tokens) Option {
+	return func(ah *APIHandler) {
+		ah.tokens = tokens
+	}
+}
+
+// Функция установки правил защиты входа от перебора паролей
+func WithLoginPolicy(policy lockout.Policy) Option {
+	return func(ah *APIHandler) {
+		ah.lockout = policy
+	}
+}
+
+// Функция включения определения IP адреса клиента по заголовкам обратного прокси.
+// Допустима, только если сервер недоступен клиентам напрямую
+func WithTrustProxy(trust bool) Option {
+	return func(ah *APIHandler) {
+		ah.trustProxy = trust
+	}
+}
+
+// Функция установки доставки уведомлений пользователям
+func WithNotifier(notifier notify.Notifier) Option {
+	return func(ah *APIHandler) {
+		ah.notifier = notifier
+	}
+}
+
+// Функция установки времени действия токена сброса пароля
+func WithPasswordResetTTL(ttl time.Duration) Option {
+	return func(ah *APIHandler) {
+		if ttl > 0 {
+			ah.resetTTL = ttl
+		}
+	}
+}
+
+// Функция установки времени действия резерва баллов
+func WithHoldTTL(ttl time.Duration) Option {
+	return func(ah *APIHandler) {
+		if ttl > 0 {
+			ah.holdTTL = ttl
+		}
+	}
+}
+
+// Подготовка СУБД и создание экземпляра хранения.
+// Без WithTokens токены подписываются случайным ключом и теряют силу при перезапуске,
+// без WithNotifier уведомления пользователей записываются в журнал
+func New(src Sourcer, sugar zap.SugaredLogger, acc *accrual.Client, opts ...Option) (*APIHandler, error) {
+	ah := &APIHandler{
+		db:       src,
+		sugar:    sugar,
+		accrual:  acc,
+		cookies:  DefaultCookieConfig,
+		lockout:  lockout.DefaultPolicy,
+		resetTTL: DefaultPasswordResetTTL,
+		holdTTL:  DefaultHoldTTL,
+	}
+	for _, opt := range opts {
+		opt(ah)
+	}
+	if ah.notifier == nil {
+		ah.notifier = notify.NewLogNotifier(&ah.sugar)
+	}
+
+	if ah.tokens == nil {
+		key, err := auth.NewRandomKey("random")
+		if err != nil {
+			return ah, err
+		}
+		if ah.tokens, err = auth.NewTokens(auth.Config{}, key); err != nil {
+			return ah, err
+		}
+	}
+
+	return ah, nil
 }
 
 //	@Summary		Register
@@ -118,7 +340,7 @@ func (ah *APIHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := ah.db.ValidateRegisterInfo(req.Login, req.Password); err != nil {
+	if err := ah.db.ValidateRegisterInfo(r.Context(), req.Login, req.Password); err != nil {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
 
 		if errors.Is(errorsapi.ErrorConflict, err) {
@@ -132,14 +354,18 @@ func (ah *APIHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = ah.db.AddUser(req.Login, req.Password)
+	err = ah.db.AddUser(r.Context(), req.Login, req.Password)
 	if err != nil {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		if errors.Is(err, errorsapi.ErrorConflict) {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		return
 	}
 
-	userID, status := LoginAction(w, ah, req.Login, req.Password)
+	userID, status := LoginAction(r.Context(), w, ah, req.Login, req.Password)
 	if status != 0 {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("login error status %d", status))
 		w.WriteHeader(status)
@@ -153,27 +379,27 @@ func (ah *APIHandler) Register(w http.ResponseWriter, r *http.Request) {
 // Сервисная функция для перепроверки токена аутентификация
 // используется для дополнительной проверки, если вдруг middleware
 // по какой-либо причине пропустит корректную обработку
-func LoginAction(w http.ResponseWriter, ah *APIHandler, login, pass string) (int, int) {
-	userID, err := ah.db.Login(login, pass)
+func LoginAction(ctx context.Context, w http.ResponseWriter, ah *APIHandler, login, pass string) (int, int) {
+	userID, err := ah.db.Login(ctx, login, pass)
 	if err != nil {
 		if errors.Is(err, errorsapi.ErrorRegInfo) {
 			return 0, http.StatusBadRequest
 		}
+		if errors.Is(err, errorsapi.ErrorUserBlocked) {
+			return 0, http.StatusForbidden
+		}
 		return 0, http.StatusInternalServerError
 	}
 
-	token, err := utils.BuildJWTString(userID)
-	if err != nil {
-		return 0, http.StatusInternalServerError
+	// неверный логин или пароль
+	if userID == 0 {
+		return 0, 0
 	}
 
-	w.Header().Add("Authorization", token)
-	cookie := http.Cookie{
-		Name:    "Authorization",
-		Expires: time.Now().Add(utils.TokenEXP),
-		Value:   token,
+	if _, err = ah.startSession(ctx, w, userID); err != nil {
+		ah.sugar.Infoln("description", err)
+		return 0, http.StatusInternalServerError
 	}
-	http.SetCookie(w, &cookie)
 	return userID, 0
 }
 
@@ -185,10 +411,16 @@ func LoginAction(w http.ResponseWriter, ah *APIHandler, login, pass string) (int
 //	@Param request body RegisterRequest true "Requst user data"
 //	@Success		200		{string}	string			"ok"
 //	@Failure		400		{string}	string	"Bad request"
+//	@Failure		401		{string}	string	"Wrong login or password"
+//	@Failure		403		{object}	ErrorResponse	"User is blocked"
+//	@Failure		429		{object}	ErrorResponse	"Too many failed login attempts"
 //	@Failure		500		{string}	string	"Internal server error"
 //	@Router			/api/user/login [post]
 //
-// Аутентификация пользователя
+// Аутентификация пользователя.
+// После неудачных попыток входа по логину или с IP адреса следующие попытки
+// откладываются, а затем блокируются: ответ 429 с заголовком Retry-After.
+// Пользователь, заблокированный администратором, получает ответ 403
 func (ah *APIHandler) Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -205,7 +437,26 @@ func (ah *APIHandler) Login(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError) // think about
 		return
 	}
-	userID, status := LoginAction(w, ah, req.Login, req.Password)
+
+	ip := ah.clientIP(r)
+	until, err := ah.db.LoginLockedUntil(r.Context(), req.Login, ip)
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if time.Now().Before(until) {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("login %s from %s is locked until %s", req.Login, ip, until))
+		writeTooManyAttempts(w, until)
+		return
+	}
+
+	userID, status := LoginAction(r.Context(), w, ah, req.Login, req.Password)
+	if status == http.StatusForbidden {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("blocked user %s login", req.Login))
+		writeForbidden(w, errorsapi.ErrorUserBlocked)
+		return
+	}
 	if status != 0 {
 		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("login error status %d", status))
 		w.WriteHeader(status)
@@ -213,10 +464,76 @@ func (ah *APIHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if userID == 0 {
+		until, err = ah.db.AddLoginFailure(r.Context(), req.Login, ip, ah.lockout)
+		if err != nil {
+			ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", fmt.Sprintf("failed login %s from %s", req.Login, ip))
+		if time.Now().Before(until) {
+			w.Header().Set("Retry-After", retryAfter(until))
+		}
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	if err = ah.db.ResetLoginFailures(r.Context(), req.Login); err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+	}
 	ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description userID", userID)
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// Функция получения IP адреса клиента: из заголовков доверенного прокси или адреса соединения
+func (ah *APIHandler) clientIP(r *http.Request) string {
+	if ah.trustProxy {
+		if ip := r.Header.Get("X-Real-IP"); ip != "" {
+			return ip
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			ip, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Функция расчёта значения Retry-After в секундах, не меньше 1
+func retryAfter(until time.Time) string {
+	seconds := int(math.Ceil(time.Until(until).Seconds()))
+	return strconv.Itoa(max(seconds, 1))
+}
+
+// Функция ответа 429 на попытку входа во время блокировки
+func writeTooManyAttempts(w http.ResponseWriter, until time.Time) {
+	resp, _ := json.Marshal(ErrorResponse{Error: "too_many_requests", Reason: "too many failed login attempts"})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", retryAfter(until))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write(resp)
+}
+
+//	@Summary		JWKS
+//	@Description	Public keys to verify user tokens
+//	@ID JWKS
+//	@Produce		json
+//	@Success		200		{object}	auth.JWKS			"ok"
+//	@Router			/.well-known/jwks.json [get]
+//
+// Открытые ключи проверки токенов пользователей
+func (ah *APIHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	resp, err := json.Marshal(ah.tokens.JWKS())
+	if err != nil {
+		ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
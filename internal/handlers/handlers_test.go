@@ -5,20 +5,22 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/closable/go-yandex-loyalty/internal/db"
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/internal/lockout"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
 )
 
 func TestAPIHandler_Register(t *testing.T) {
-	if len(dsn) == 0 {
-		initDSN()
-	}
-	src, _ := db.NewDB(dsn)
+	initAccrual()
+	src := memory.New()
 	logger := NewLogger()
 	sugar := *logger.Sugar()
-	ah, _ := New(src, sugar, acc)
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
 	type wants struct {
 		body       string
 		statusCode int
@@ -73,13 +75,11 @@ func TestAPIHandler_Register(t *testing.T) {
 }
 
 func TestAPIHandler_Login(t *testing.T) {
-	if len(dsn) == 0 {
-		initDSN()
-	}
-	src, _ := db.NewDB(dsn)
+	initAccrual()
+	src := memory.New()
 	logger := NewLogger()
 	sugar := *logger.Sugar()
-	ah, _ := New(src, sugar, acc)
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
 	type wants struct {
 		body       string
 		statusCode int
@@ -140,14 +140,60 @@ func TestAPIHandler_Login(t *testing.T) {
 	}
 }
 
-func ExampleAPIHandler_Login() {
-	if len(dsn) == 0 {
-		initDSN()
+func TestAPIHandler_LoginLockout(t *testing.T) {
+	initAccrual()
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	ah, _ := New(memory.New(), sugar, accrual.New(acc, time.Second*5, 10, &sugar), WithLoginPolicy(lockout.Policy{
+		Login:  lockout.Rule{Free: 2, Threshold: 2, Lockout: time.Minute},
+		IP:     lockout.Rule{Threshold: 5, Lockout: time.Minute},
+		Window: time.Minute,
+	}))
+
+	login := func(body, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(body))
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		ah.Login(w, r)
+		return w
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/user/register", strings.NewReader(`{"login": "lockout", "password": "secret"}`))
+	ah.Register(httptest.NewRecorder(), r)
+
+	wrong := `{"login": "lockout", "password": "wrong"}`
+	right := `{"login": "lockout", "password": "secret"}`
+	if w := login(wrong, "192.0.2.1:1234"); w.Code != http.StatusUnauthorized || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("first failure status = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := login(wrong, "192.0.2.1:1234"); w.Code != http.StatusUnauthorized || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("locking failure status = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
 	}
-	src, _ := db.NewDB(dsn)
+
+	// во время блокировки не принимается даже верный пароль, в том числе с другого адреса
+	w := login(right, "198.51.100.1:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked login status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retry, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retry < 1 || retry > 60 {
+		t.Errorf("Retry-After = %q", w.Header().Get("Retry-After"))
+	}
+
+	// перебор разных логинов с одного адреса блокирует адрес
+	for i := 0; i < 5; i++ {
+		login(fmt.Sprintf(`{"login": "unknown%d", "password": "wrong"}`, i), "203.0.113.1:1234")
+	}
+	if w := login(`{"login": "unknown", "password": "wrong"}`, "203.0.113.1:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("locked IP status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func ExampleAPIHandler_Login() {
+	initAccrual()
+	src := memory.New()
 	logger := NewLogger()
 	sugar := *logger.Sugar()
-	ah, _ := New(src, sugar, acc)
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
 
 	// statusCode := http.StatusOK
 	bodyReader := strings.NewReader(fmt.Sprintf(`{"login": "test%d", "password": "test%d"}`, 123, 123))
@@ -162,13 +208,11 @@ func ExampleAPIHandler_Login() {
 }
 
 func ExampleAPIHandler_Register() {
-	if len(dsn) == 0 {
-		initDSN()
-	}
-	src, _ := db.NewDB(dsn)
+	initAccrual()
+	src := memory.New()
 	logger := NewLogger()
 	sugar := *logger.Sugar()
-	ah, _ := New(src, sugar, acc)
+	ah, _ := New(src, sugar, accrual.New(acc, time.Second*5, 10, &sugar))
 
 	// statusCode := http.StatusOK
 	bodyReader := strings.NewReader(fmt.Sprintf(`{"login": "test%d", "password": "test%d"}`, 123, 123))
@@ -1,52 +1,120 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"expvar"
 	"fmt"
 	"net/http"
 	"net/http/pprof"
-	"net/url"
+	"strings"
 
-	"github.com/closable/go-yandex-loyalty/internal/utils"
+	"github.com/closable/go-yandex-loyalty/internal/auth"
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
 	"github.com/go-chi/chi/v5"
 )
 
-// Middleware для контроля за аутентифированными пользователями
+// Ошибка проверки сессии в системе хранения
+var errSessionCheck = errors.New("session check failed")
+
+// Middleware для контроля за аутентифированными пользователями.
+// Запрос с отсутствующим или недействительным токеном завершается ответом 401 с причиной отказа.
+// Изменяющий запрос, аутентифицированный cookie, требует CSRF токена (ответ 403),
+// клиенты, передающие токен в заголовке Authorization, от проверки освобождены
 func (ah *APIHandler) Authenticator(h http.Handler) http.Handler {
 	auth := func(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Set("Content-Type", "application/json")
 
-		var userID int
-		token, _ := r.Cookie("Authorization")
-		headerAuth := r.Header.Get("Authorization")
-		//fmt.Printf("-1 %s 2- %s 3- %s ", token, errCookie, headerAuth)
-
-		if len(token.String()) > 0 {
-			userID = utils.GetUserID(token.Value)
-			w.Header().Add("Authorization", token.Value)
-			//fmt.Printf("user get from existing cookies %d\n", userID)
+		user, token, fromCookie, err := ah.authenticate(r)
+		if err != nil {
+			ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+			if errors.Is(err, errSessionCheck) {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			writeUnauthorized(w, err)
+			return
 		}
-
-		if len(headerAuth) > 0 && userID == 0 {
-			userID = utils.GetUserID(headerAuth)
-			w.Header().Add("Authorization", headerAuth)
-			//fmt.Printf("user get from existing header %d\n", userID)
+		if fromCookie {
+			if err = checkCSRF(r); err != nil {
+				ah.sugar.Infoln("uri", r.RequestURI, "method", r.Method, "description", err)
+				writeForbidden(w, err)
+				return
+			}
 		}
+		w.Header().Add("Authorization", token)
 
-		values := url.Values{}
-		values.Add("userID", fmt.Sprintf("%d", userID))
-		r.PostForm = values
+		h.ServeHTTP(w, r.WithContext(ContextWithUser(r.Context(), user)))
+	}
 
-		if userID == 0 {
-			w.WriteHeader(http.StatusUnauthorized)
+	return http.HandlerFunc(auth)
+}
+
+// Middleware для ограничения доступа к группе маршрутов пользователями с одной из ролей,
+// подключается после Authenticator. Запрос пользователя без нужной роли завершается ответом 403
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				writeUnauthorized(w, auth.ErrorTokenMissing)
+				return
+			}
+			if !user.HasRole(roles...) {
+				writeForbidden(w, errorsapi.ErrorRoleRequired)
+				return
+			}
 			h.ServeHTTP(w, r)
-			return
+		})
+	}
+}
+
+// Функция проверки токена запроса: сначала заголовок Authorization, затем cookie.
+// Признак fromCookie означает, что запрос аутентифицирован cookie
+func (ah *APIHandler) authenticate(r *http.Request) (Principal, string, bool, error) {
+	tokens := make([]string, 0, 2)
+	if header := r.Header.Get("Authorization"); header != "" {
+		tokens = append(tokens, strings.TrimPrefix(header, "Bearer "))
+	}
+	cookieIdx := len(tokens)
+	if cookie, err := r.Cookie(accessCookie); err == nil && cookie.Value != "" {
+		tokens = append(tokens, cookie.Value)
+	}
+
+	err := auth.ErrorTokenMissing
+	for i, token := range tokens {
+		var claims *auth.Claims
+		if claims, err = ah.tokens.Parse(token); err != nil {
+			continue
+		}
+
+		// токен отозванной сессии не принимается
+		active, errSession := ah.db.SessionActive(r.Context(), claims.SessionID)
+		if errSession != nil {
+			return Principal{}, "", false, fmt.Errorf("%w: %w", errSessionCheck, errSession)
+		}
+		if !active {
+			err = auth.ErrorSessionRevoked
+			continue
 		}
-		h.ServeHTTP(w, r)
+
+		return Principal{
+			UserID:    claims.UserID,
+			Roles:     claims.Roles,
+			TokenID:   claims.ID,
+			SessionID: claims.SessionID,
+		}, token, i == cookieIdx, nil
 	}
+	return Principal{}, "", false, err
+}
 
-	return http.HandlerFunc(auth)
+// Функция ответа 401 с причиной отказа в аутентификации
+func writeUnauthorized(w http.ResponseWriter, reason error) {
+	resp, _ := json.Marshal(ErrorResponse{Error: "unauthorized", Reason: reason.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write(resp)
 }
 
 // Middleware для работы профилировщика pprof
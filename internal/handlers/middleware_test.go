@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/accrual"
+	"github.com/closable/go-yandex-loyalty/internal/auth"
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
+)
+
+func TestAPIHandler_Authenticator(t *testing.T) {
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	key := auth.NewHMACKey("test", []byte("secret"))
+	tokens, _ := auth.NewTokens(auth.Config{Issuer: "gophermart", Audience: []string{"gophermart"}}, key)
+	src := memory.New()
+	ah, _ := New(src, sugar, accrual.New("", time.Second, 1, &sugar), WithTokens(tokens))
+
+	ctx := context.Background()
+	src.CreateSession(ctx, 4, "session", "hash", time.Now().Add(time.Hour))
+	src.CreateSession(ctx, 4, "revoked", "hash", time.Now().Add(time.Hour))
+	src.RevokeSession(ctx, 4, "revoked")
+
+	valid, _ := tokens.Build(4, "session")
+	revoked, _ := tokens.Build(4, "revoked")
+	other, _ := auth.NewTokens(auth.Config{Issuer: "shop"}, key)
+	otherIssuer, _ := other.Build(4, "session")
+	forged, _ := auth.NewTokens(auth.Config{Issuer: "gophermart", Audience: []string{"gophermart"}}, auth.NewHMACKey("test", []byte("guess")))
+	badSignature, _ := forged.Build(4, "session")
+
+	tests := []struct {
+		name       string
+		cookie     string
+		header     string
+		statusCode int
+		reason     string
+	}{
+		{name: "valid header", header: valid, statusCode: http.StatusOK},
+		{name: "valid bearer header", header: "Bearer " + valid, statusCode: http.StatusOK},
+		{name: "valid cookie", cookie: valid, statusCode: http.StatusOK},
+		{name: "invalid cookie valid header", cookie: badSignature, header: valid, statusCode: http.StatusOK},
+		{name: "missing token", statusCode: http.StatusUnauthorized, reason: auth.ErrorTokenMissing.Error()},
+		{name: "bad signature", header: badSignature, statusCode: http.StatusUnauthorized, reason: auth.ErrorTokenSignature.Error()},
+		{name: "wrong issuer", header: otherIssuer, statusCode: http.StatusUnauthorized, reason: auth.ErrorTokenIssuer.Error()},
+		{name: "revoked session", header: revoked, statusCode: http.StatusUnauthorized, reason: auth.ErrorSessionRevoked.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				if user, ok := UserFromContext(r.Context()); !ok || user.UserID != 4 || user.TokenID == "" {
+					t.Errorf("UserFromContext() = %v, %v, want user 4", user, ok)
+				}
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "Authorization", Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			ah.Authenticator(next).ServeHTTP(w, r)
+
+			if w.Code != tt.statusCode || called != (tt.statusCode == http.StatusOK) {
+				t.Fatalf("status = %d, next called %v, want %d", w.Code, called, tt.statusCode)
+			}
+			if tt.reason != "" {
+				resp := ErrorResponse{}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Reason != tt.reason {
+					t.Errorf("body = %s, want reason %q", w.Body.String(), tt.reason)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIHandler_CSRF(t *testing.T) {
+	logger := NewLogger()
+	sugar := *logger.Sugar()
+	ah, _ := New(memory.New(), sugar, accrual.New("", time.Second, 1, &sugar),
+		WithCookies(CookieConfig{Secure: true, SameSite: http.SameSiteStrictMode}))
+	router := ah.InitRouter()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/user/register", strings.NewReader(`{"login": "csrf", "password": "secret"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("register status = %d", w.Code)
+	}
+
+	cookies := make(map[string]*http.Cookie)
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	access, csrf := cookies[accessCookie], cookies[csrfCookie]
+	if access == nil || !access.HttpOnly || !access.Secure || access.SameSite != http.SameSiteStrictMode || access.Path != "/" {
+		t.Fatalf("access cookie = %v", access)
+	}
+	if refresh := cookies[refreshCookie]; refresh == nil || !refresh.HttpOnly || refresh.Path != refreshPath {
+		t.Fatalf("refresh cookie = %v", refresh)
+	}
+	if csrf == nil || csrf.HttpOnly || csrf.Value != w.Header().Get(csrfHeader) {
+		t.Fatalf("csrf cookie = %v, header %q", csrf, w.Header().Get(csrfHeader))
+	}
+	token := w.Header().Get("Authorization")
+
+	tests := []struct {
+		name       string
+		method     string
+		cookie     bool
+		header     bool
+		csrf       string
+		statusCode int
+	}{
+		{name: "cookie safe method", method: http.MethodGet, cookie: true, statusCode: http.StatusOK},
+		{name: "cookie without csrf", method: http.MethodPost, cookie: true, statusCode: http.StatusForbidden},
+		{name: "cookie wrong csrf", method: http.MethodPost, cookie: true, csrf: "guess", statusCode: http.StatusForbidden},
+		{name: "cookie with csrf", method: http.MethodPost, cookie: true, csrf: csrf.Value, statusCode: http.StatusOK},
+		{name: "bearer header", method: http.MethodPost, header: true, statusCode: http.StatusOK},
+		{name: "bearer header with cookie", method: http.MethodPost, cookie: true, header: true, statusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			r := httptest.NewRequest(tt.method, "/api/user/logout", nil)
+			if tt.cookie {
+				r.AddCookie(access)
+				r.AddCookie(csrf)
+			}
+			if tt.header {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			if tt.csrf != "" {
+				r.Header.Set(csrfHeader, tt.csrf)
+			}
+			w := httptest.NewRecorder()
+			ah.Authenticator(next).ServeHTTP(w, r)
+
+			if w.Code != tt.statusCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.statusCode)
+			}
+			if tt.statusCode == http.StatusForbidden {
+				resp := ErrorResponse{}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Reason != errorsapi.ErrorCSRFToken.Error() {
+					t.Errorf("body = %s, want reason %q", w.Body.String(), errorsapi.ErrorCSRFToken)
+				}
+			}
+		})
+	}
+
+	// обновление токенов по refresh cookie также требует CSRF токена
+	refresh := func(csrfValue string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/token/refresh", nil)
+		r.AddCookie(cookies[refreshCookie])
+		r.AddCookie(csrf)
+		if csrfValue != "" {
+			r.Header.Set(csrfHeader, csrfValue)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := refresh(""); code != http.StatusForbidden {
+		t.Errorf("refresh by cookie without csrf status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := refresh(csrf.Value); code != http.StatusOK {
+		t.Errorf("refresh by cookie with csrf status = %d, want %d", code, http.StatusOK)
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	_ "github.com/closable/go-yandex-loyalty/docs" // docs is generated by Swag CLI, you have to import it.
+	"github.com/closable/go-yandex-loyalty/models"
 	"github.com/go-chi/chi/v5"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
@@ -12,6 +13,10 @@ func (ah *APIHandler) InitRouter() chi.Router {
 
 	router.Post("/api/user/register", ah.Register)
 	router.Post("/api/user/login", ah.Login)
+	router.Post("/api/user/token/refresh", ah.Refresh)
+	router.Post("/api/user/password/reset/request", ah.RequestPasswordReset)
+	router.Post("/api/user/password/reset/confirm", ah.ConfirmPasswordReset)
+	router.Get("/.well-known/jwks.json", ah.JWKS)
 
 	router.Mount("/debug", Profiler())
 	router.Get("/swagger/*", httpSwagger.WrapHandler)
@@ -23,6 +28,37 @@ func (ah *APIHandler) InitRouter() chi.Router {
 		r.Post("/api/user/balance/withdraw", ah.GetWithdraw)
 		r.Get("/api/user/withdrawals", ah.Withdrawals)
 		r.Get("/api/user/balance", ah.Balance)
+		r.Get("/api/user/history", ah.History)
+		r.Post("/api/user/balance/holds", ah.CreateHold)
+		r.Post("/api/user/balance/holds/{order}/capture", ah.CaptureHold)
+		r.Post("/api/user/balance/holds/{order}/release", ah.ReleaseHold)
+		r.Post("/api/user/logout", ah.Logout)
+		r.Post("/api/user/logout-all", ah.LogoutAll)
+		r.Post("/api/user/password", ah.ChangePassword)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(ah.Authenticator, RequireRole(models.RoleSupport, models.RoleAdmin))
+		r.Get("/api/support/users/{id}/orders", ah.SupportOrders)
+		r.Get("/api/support/users/{id}/balance", ah.SupportBalance)
+		r.Get("/api/support/users/{id}/history", ah.SupportHistory)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(ah.Authenticator, RequireRole(models.RoleAdmin))
+		r.Get("/api/admin/users", ah.ListUsers)
+		r.Put("/api/admin/users/{id}/role", ah.SetUserRole)
+		r.Post("/api/admin/users/{id}/block", ah.BlockUser)
+		r.Post("/api/admin/users/{id}/unblock", ah.UnblockUser)
+		r.Post("/api/admin/users/{id}/adjustments", ah.AddAdjustment)
+		r.Post("/api/admin/withdrawals/{order}/reverse", ah.AdminReverseWithdraw)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(ah.ShopAuthenticator)
+		r.Post("/api/shop/withdrawals/{order}/reverse", ah.ShopReverseWithdraw)
+		r.Post("/api/shop/holds/{order}/capture", ah.ShopCaptureHold)
+		r.Post("/api/shop/holds/{order}/release", ah.ShopReleaseHold)
 	})
 
 	return router
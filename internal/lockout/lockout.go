@@ -0,0 +1,74 @@
+// Пакет правил защиты входа от перебора паролей.
+// Неудачные попытки входа считаются отдельно по логину и по IP адресу клиента:
+// после нескольких бесплатных попыток каждая следующая откладывается на растущую
+// задержку, а после достижения порога вход блокируется на время блокировки
+package lockout
+
+import "time"
+
+// Правило блокировки по одному счётчику неудачных попыток
+type Rule struct {
+	// Количество неудачных попыток без задержки
+	Free int
+	// Задержка после первой попытки сверх бесплатных, удваивается с каждой попыткой
+	Delay time.Duration
+	// Максимальная задержка
+	MaxDelay time.Duration
+	// Количество неудачных попыток, после которого вход блокируется, 0 без блокировки
+	Threshold int
+	// Время блокировки
+	Lockout time.Duration
+}
+
+// Предельная задержка, если максимальная задержка правила не задана
+const limitDelay = time.Hour * 24
+
+// Правила блокировки входа
+type Policy struct {
+	// Правило для логина пользователя
+	Login Rule
+	// Правило для IP адреса клиента, порог выше из-за общих адресов NAT
+	IP Rule
+	// Неудачные попытки старше окна не учитываются, счётчик начинается заново
+	Window time.Duration
+}
+
+// Правила по умолчанию
+var DefaultPolicy = Policy{
+	Login: Rule{
+		Free:      3,
+		Delay:     time.Second,
+		MaxDelay:  time.Second * 30,
+		Threshold: 10,
+		Lockout:   time.Minute * 15,
+	},
+	IP: Rule{
+		Free:      10,
+		Delay:     time.Second,
+		MaxDelay:  time.Second * 30,
+		Threshold: 100,
+		Lockout:   time.Minute * 15,
+	},
+	Window: time.Minute * 15,
+}
+
+// Функция расчёта времени, до которого запрещён вход после failures неудачных попыток.
+// Нулевое время означает, что следующая попытка разрешена сразу
+func (r Rule) Until(failures int, now time.Time) time.Time {
+	if r.Threshold > 0 && failures >= r.Threshold {
+		return now.Add(r.Lockout)
+	}
+	if failures <= r.Free || r.Delay <= 0 {
+		return time.Time{}
+	}
+
+	maxDelay := r.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = limitDelay
+	}
+	delay := r.Delay
+	for i := r.Free + 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return now.Add(min(delay, maxDelay))
+}
@@ -0,0 +1,40 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRule_Until(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	rule := Rule{Free: 2, Delay: time.Second, MaxDelay: time.Second * 5, Threshold: 8, Lockout: time.Minute}
+
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{name: "no failures", failures: 0},
+		{name: "free attempts", failures: 2},
+		{name: "first delay", failures: 3, want: time.Second},
+		{name: "doubled delay", failures: 4, want: time.Second * 2},
+		{name: "max delay", failures: 7, want: time.Second * 5},
+		{name: "lockout", failures: 8, want: time.Minute},
+		{name: "after lockout", failures: 20, want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rule.Until(tt.failures, now)
+			if tt.want == 0 && !got.IsZero() {
+				t.Fatalf("Until(%d) = %v, want zero", tt.failures, got)
+			}
+			if tt.want != 0 && got.Sub(now) != tt.want {
+				t.Errorf("Until(%d) = %v, want %v", tt.failures, got.Sub(now), tt.want)
+			}
+		})
+	}
+
+	if got := (Rule{Free: 1, Delay: time.Second}).Until(100, now); got.Sub(now) <= 0 {
+		t.Errorf("Until() without threshold and max delay = %v, want delay", got)
+	}
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Ручная корректировка баланса
+type adjustment struct {
+	userID     int
+	operatorID int
+	amount     models.Money
+	reason     string
+	comment    string
+	createdAt  time.Time
+}
+
+// Функция ручной корректировки баланса пользователя оператором, возвращает ID корректировки.
+// Положительная сумма зачисляется, отрицательная списывается и не может превысить остаток,
+// кроме изъятия по коду FRAUD, после которого остаток может стать отрицательным.
+// Корректировка проводится по журналу с типом ADJUSTMENT и не учитывается в сумме списаний
+func (s *Store) AddAdjustment(ctx context.Context, userID, operatorID int, amount models.Money, reason, comment string) (int64, error) {
+	if amount == 0 || !models.ValidAdjustmentReason(reason) {
+		return 0, errorsapi.ErrorRegInfo
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userByID(userID) == nil {
+		return 0, errorsapi.ErrorUserNotFound
+	}
+	if s.available(userID)+amount < 0 && !models.AdjustmentAllowsNegative(reason) {
+		return 0, errorsapi.ErrorInsufficientFunds
+	}
+
+	adjustmentID := int64(len(s.adjustments) + 1)
+	reference := strconv.FormatInt(adjustmentID, 10)
+	s.adjustments[reference] = &adjustment{
+		userID:     userID,
+		operatorID: operatorID,
+		amount:     amount,
+		reason:     reason,
+		comment:    comment,
+		createdAt:  s.now(),
+	}
+	s.post(userID, models.EntryAdjustment, reference, amount)
+	return adjustmentID, nil
+}
+
+// Функция получения истории операций по счёту пользователя в порядке проведения
+func (s *Store) GetHistory(ctx context.Context, userID int) ([]models.HistoryDB, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]models.HistoryDB, 0)
+	for _, e := range s.entries {
+		if e.userID != userID {
+			continue
+		}
+		item := models.HistoryDB{
+			Type:      e.entryType,
+			Reference: e.reference,
+			Amount:    e.amount,
+			CreatedAt: formatTime(e.createdAt),
+		}
+		if adj, ok := s.adjustments[e.reference]; ok && e.entryType == models.EntryAdjustment {
+			item.Reason = adj.reason
+		}
+		res = append(res, item)
+	}
+	return res, nil
+}
@@ -0,0 +1,172 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Резерв баллов под списание
+type hold struct {
+	userID    int
+	order     string
+	sum       models.Money
+	status    string
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// Функция резервирования баллов пользователя под списание по заказу до expiresAt.
+// Резерв уменьшает доступный остаток, но не проводится по журналу до подтверждения
+func (s *Store) CreateHold(ctx context.Context, userID int, orderNumber string, sum models.Money, expiresAt time.Time) (models.HoldDB, error) {
+	if sum <= 0 || len(orderNumber) > models.MaxOrderNumberLen {
+		return models.HoldDB{}, errorsapi.ErrorRegInfo
+	}
+	if err := ctx.Err(); err != nil {
+		return models.HoldDB{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.available(userID) < sum {
+		return models.HoldDB{}, errorsapi.ErrorInsufficientFunds
+	}
+	if _, ok := s.withdrawn[orderNumber]; ok {
+		return models.HoldDB{}, errorsapi.ErrorConflict
+	}
+	if _, ok := s.holds[orderNumber]; ok {
+		return models.HoldDB{}, errorsapi.ErrorConflict
+	}
+
+	h := &hold{
+		userID:    userID,
+		order:     orderNumber,
+		sum:       sum,
+		status:    models.HoldHeld,
+		createdAt: s.now(),
+		expiresAt: expiresAt,
+	}
+	s.holds[orderNumber] = h
+	s.account(userID).held += sum
+	return h.model(), nil
+}
+
+// Функция подтверждения резерва: зарезервированные баллы списываются по заказу резерва.
+// Для уже подтверждённого резерва возвращает его и ErrorInfoFound.
+// userID ограничивает поиск резервами пользователя, 0 — любой резерв
+func (s *Store) CaptureHold(ctx context.Context, userID int, orderNumber string) (models.HoldDB, error) {
+	return s.closeHold(ctx, userID, orderNumber, models.HoldCaptured, func(h *hold) error {
+		if !h.expiresAt.After(s.now()) {
+			return errorsapi.ErrorHoldClosed
+		}
+		if _, ok := s.withdrawn[orderNumber]; ok {
+			return errorsapi.ErrorConflict
+		}
+		w := &withdraw{
+			userID:      h.userID,
+			order:       orderNumber,
+			sum:         h.sum,
+			processedAt: s.now(),
+		}
+		s.withdrawals = append(s.withdrawals, w)
+		s.withdrawn[orderNumber] = w
+		s.account(h.userID).held -= h.sum
+		s.post(h.userID, models.EntryWithdrawal, orderNumber, -h.sum)
+		return nil
+	})
+}
+
+// Функция отмены резерва, баллы снова становятся доступны.
+// Для уже отменённого или истёкшего резерва возвращает его и ErrorInfoFound.
+// userID ограничивает поиск резервами пользователя, 0 — любой резерв
+func (s *Store) ReleaseHold(ctx context.Context, userID int, orderNumber string) (models.HoldDB, error) {
+	return s.closeHold(ctx, userID, orderNumber, models.HoldReleased, func(h *hold) error {
+		s.account(h.userID).held -= h.sum
+		return nil
+	})
+}
+
+// Функция снятия не более limit истёкших резервов, возвращает количество снятых резервов
+func (s *Store) ExpireHolds(ctx context.Context, limit int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	expired := make([]*hold, 0)
+	for _, h := range s.holds {
+		if h.status == models.HoldHeld && !h.expiresAt.After(now) {
+			expired = append(expired, h)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].expiresAt.Before(expired[j].expiresAt) })
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+
+	for _, h := range expired {
+		h.status = models.HoldExpired
+		s.account(h.userID).held -= h.sum
+	}
+	return len(expired), nil
+}
+
+// Функция перевода резерва в состояние status, apply выполняет изменения счёта.
+// Резерв в состоянии status возвращается с ErrorInfoFound, в другом конечном состоянии — ErrorHoldClosed
+func (s *Store) closeHold(ctx context.Context, userID int, orderNumber, status string, apply func(h *hold) error) (models.HoldDB, error) {
+	if err := ctx.Err(); err != nil {
+		return models.HoldDB{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.holds[orderNumber]
+	if !ok || (userID != 0 && h.userID != userID) {
+		return models.HoldDB{}, errorsapi.ErrorHoldNotFound
+	}
+
+	switch {
+	case h.status == status,
+		// истёкший резерв уже отменён
+		status == models.HoldReleased && h.status == models.HoldExpired:
+		return h.model(), errorsapi.ErrorInfoFound
+	case h.status != models.HoldHeld:
+		return h.model(), errorsapi.ErrorHoldClosed
+	}
+
+	if err := apply(h); err != nil {
+		return models.HoldDB{}, err
+	}
+	h.status = status
+	return h.model(), nil
+}
+
+// Функция получения счёта пользователя, при отсутствии счёт создаётся.
+// Вызывается под блокировкой хранилища
+func (s *Store) account(userID int) *account {
+	acc, ok := s.accounts[userID]
+	if !ok {
+		acc = &account{}
+		s.accounts[userID] = acc
+	}
+	return acc
+}
+
+// Функция преобразования резерва в модель приложения
+func (h *hold) model() models.HoldDB {
+	return models.HoldDB{
+		Order:     h.order,
+		Sum:       h.sum,
+		Status:    h.status,
+		CreatedAt: formatTime(h.createdAt),
+		ExpiresAt: formatTime(h.expiresAt),
+	}
+}
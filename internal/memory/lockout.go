@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/lockout"
+)
+
+// Функция получения времени, до которого вход по логину или с IP адреса запрещён.
+// Нулевое время означает, что вход разрешён
+func (s *Store) LoginLockedUntil(ctx context.Context, login, ip string) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var until time.Time
+	if u, ok := s.users[login]; ok {
+		until = u.failures.lockedUntil
+	}
+	if a, ok := s.ipFailures[ip]; ok && a.lockedUntil.After(until) {
+		until = a.lockedUntil
+	}
+	return until, nil
+}
+
+// Функция учёта неудачной попытки входа по логину и IP адресу.
+// Возвращает время, до которого следующая попытка запрещена правилами policy
+func (s *Store) AddLoginFailure(ctx context.Context, login, ip string, policy lockout.Policy) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	// неизвестный логин не учитывается, попытки ограничиваются счётчиком IP адреса
+	var until time.Time
+	if u, ok := s.users[login]; ok {
+		until = u.failures.add(policy.Login, policy.Window, now)
+	}
+
+	a, ok := s.ipFailures[ip]
+	if !ok {
+		a = &attempts{}
+		s.ipFailures[ip] = a
+	}
+	if ipUntil := a.add(policy.IP, policy.Window, now); ipUntil.After(until) {
+		until = ipUntil
+	}
+	return until, nil
+}
+
+// Функция сброса счётчика неудачных попыток входа по логину после успешного входа.
+// Счётчик IP адреса не сбрасывается, чтобы вход в свою учётную запись не открывал перебор чужих
+func (s *Store) ResetLoginFailures(ctx context.Context, login string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[login]; ok {
+		u.failures = attempts{}
+	}
+	return nil
+}
+
+// Функция учёта неудачной попытки, попытки старше окна не учитываются
+func (a *attempts) add(rule lockout.Rule, window time.Duration, now time.Time) time.Time {
+	if now.Sub(a.lastFailedAt) >= window {
+		a.failures = 0
+	}
+	a.failures++
+	a.lastFailedAt = now
+	a.lockedUntil = rule.Until(a.failures, now)
+	return a.lockedUntil
+}
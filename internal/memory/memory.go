@@ -0,0 +1,635 @@
+// Пакет хранения информации в памяти процесса. Реализует handlers.Sourcer
+// и backgrounds.Queue с той же семантикой, что и db.Store (конфликты,
+// баланс, статусы заказов), и предназначен для тестов и локальных демонстраций
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/internal/passwd"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Ошибка, запись не найдена
+var errNotFound = errors.New("record not found")
+
+type (
+	// Пользователь
+	user struct {
+		id     int
+		name   string
+		passw  string
+		status bool
+		role   string
+		// причина и время блокировки администратором
+		blockedReason string
+		blockedAt     time.Time
+		// неудачные попытки входа по логину
+		failures attempts
+	}
+	// Счётчик неудачных попыток входа
+	attempts struct {
+		failures     int
+		lastFailedAt time.Time
+		lockedUntil  time.Time
+	}
+	// Заказ и его состояние в очереди синхронизации
+	order struct {
+		seq        int
+		userID     int
+		number     string
+		status     string
+		accrual    models.Money
+		uploadedAt time.Time
+		attempts   int
+		// nil, если заказ исключён из очереди
+		nextAttemptAt *time.Time
+		lockedUntil   time.Time
+	}
+	// Списание
+	withdraw struct {
+		userID      int
+		order       string
+		sum         models.Money
+		processedAt time.Time
+		// отмена списания
+		reversedAt     time.Time
+		reversedBy     string
+		reversalReason string
+	}
+	// Счёт пользователя
+	account struct {
+		balance   models.Money
+		withdrawn models.Money
+		// зарезервировано под списания
+		held models.Money
+	}
+	// Проводка по счёту пользователя
+	entry struct {
+		userID    int
+		entryType string
+		reference string
+		amount    models.Money
+		createdAt time.Time
+	}
+	// Сессия пользователя
+	session struct {
+		userID      int
+		refreshHash string
+		expiresAt   time.Time
+		revoked     bool
+	}
+)
+
+// Структура хранения информации в памяти
+type Store struct {
+	mu          sync.Mutex
+	seq         int
+	users       map[string]*user
+	orders      map[string]*order
+	withdrawals []*withdraw
+	withdrawn   map[string]*withdraw
+	accounts    map[int]*account
+	sessions    map[string]*session
+	// неудачные попытки входа по IP адресу
+	ipFailures map[string]*attempts
+	// токены сброса пароля по хэшу
+	resets map[string]*passwordReset
+	// выполненные проводки: тип и ссылка
+	posted map[string]bool
+	// журнал проводок в порядке проведения
+	entries []*entry
+	// ручные корректировки баланса по ID
+	adjustments map[string]*adjustment
+	// резервы баллов по номеру заказа
+	holds  map[string]*hold
+	hasher *passwd.Hasher
+	now    func() time.Time
+}
+
+// Параметр хранилища в памяти
+type Option func(s *Store)
+
+// Функция установки стоимости хэширования паролей
+func WithPasswordCost(cost int) Option {
+	return func(s *Store) {
+		s.hasher = passwd.New(cost)
+	}
+}
+
+// Функция создания хранилища в памяти
+func New(opts ...Option) *Store {
+	s := &Store{
+		users:       make(map[string]*user),
+		orders:      make(map[string]*order),
+		withdrawn:   make(map[string]*withdraw),
+		accounts:    make(map[int]*account),
+		sessions:    make(map[string]*session),
+		ipFailures:  make(map[string]*attempts),
+		resets:      make(map[string]*passwordReset),
+		posted:      make(map[string]bool),
+		adjustments: make(map[string]*adjustment),
+		holds:       make(map[string]*hold),
+		hasher:      passwd.New(passwd.DefaultCost),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Функция форматирования времени так же, как database/sql приводит timestamptz к строке
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// Функция проверки полноты заполнения информации о пользователе
+func (s *Store) ValidateRegisterInfo(ctx context.Context, login, pass string) error {
+	if len(login) == 0 || len(pass) == 0 {
+		return errorsapi.ErrorRegInfo
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[login]; ok {
+		return errorsapi.ErrorConflict
+	}
+	return nil
+}
+
+// Функция добавления нового пользователя
+func (s *Store) AddUser(ctx context.Context, login, pass string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	hash, err := s.hasher.Hash(pass)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[login]; ok {
+		return errorsapi.ErrorConflict
+	}
+	s.seq++
+	s.users[login] = &user{
+		id:     s.seq,
+		name:   login,
+		passw:  hash,
+		status: true,
+		role:   models.RoleUser,
+	}
+	return nil
+}
+
+// Функция аутентфикации пользователя, для неизвестного пользователя возвращает 0.
+// Устаревший хэш пароля при успешном входе заменяется хэшем с текущими параметрами.
+// Заблокированному пользователю после проверки пароля возвращается ErrorUserBlocked
+func (s *Store) Login(ctx context.Context, login, pass string) (int, error) {
+	if len(login) == 0 || len(pass) == 0 {
+		return 0, errorsapi.ErrorRegInfo
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	u, ok := s.users[login]
+	if !ok {
+		s.mu.Unlock()
+		return 0, nil
+	}
+	id, oldHash, active := u.id, u.passw, u.status
+	s.mu.Unlock()
+
+	// проверка и хэширование пароля выполняются без блокировки хранилища
+	ok, rehash := s.hasher.Verify(oldHash, pass)
+	if !ok {
+		return 0, nil
+	}
+	if !active {
+		return 0, errorsapi.ErrorUserBlocked
+	}
+	if rehash {
+		hash, err := s.hasher.Hash(pass)
+		if err != nil {
+			return 0, err
+		}
+		s.mu.Lock()
+		if u.passw == oldHash {
+			u.passw = hash
+		}
+		s.mu.Unlock()
+	}
+	return id, nil
+}
+
+// Функция получения списка заказов по userID, новые заказы первыми
+func (s *Store) GetOrders(ctx context.Context, userID int) ([]models.OrdersDB, error) {
+	res := make([]models.OrdersDB, 0)
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]*order, 0)
+	for _, o := range s.orders {
+		if o.userID == userID {
+			list = append(list, o)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].uploadedAt.Equal(list[j].uploadedAt) {
+			return list[i].uploadedAt.After(list[j].uploadedAt)
+		}
+		return list[i].seq > list[j].seq
+	})
+
+	for _, o := range list {
+		res = append(res, models.OrdersDB{
+			OrderNumber: o.number,
+			Status:      o.status,
+			Accrual:     o.accrual,
+			UploadAt:    formatTime(o.uploadedAt),
+		})
+	}
+	return res, nil
+}
+
+// Функция получеиня баланса: доступный остаток без зарезервированных баллов,
+// сумма списаний и сумма резервов
+func (s *Store) Balance(ctx context.Context, userID int) (models.WithdrawDB, error) {
+	if err := ctx.Err(); err != nil {
+		return models.WithdrawDB{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.accounts[userID]
+	if !ok {
+		return models.WithdrawDB{}, nil
+	}
+	return models.WithdrawDB{
+		Current:   acc.balance - acc.held,
+		Withdrawn: acc.withdrawn,
+		Held:      acc.held,
+	}, nil
+}
+
+// Функция получения доступного остатка без зарезервированных баллов,
+// вызывается под блокировкой хранилища
+func (s *Store) available(userID int) models.Money {
+	acc, ok := s.accounts[userID]
+	if !ok {
+		return 0
+	}
+	return acc.balance - acc.held
+}
+
+// Фукция добавления заказа пользователя
+func (s *Store) AddOrder(ctx context.Context, userID int, orderNumber, accStatus string, accrual models.Money) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if o, ok := s.orders[orderNumber]; ok {
+		if o.userID != userID {
+			return errorsapi.ErrorConflict
+		}
+		return errorsapi.ErrorInfoFound
+	}
+
+	now := s.now()
+	s.seq++
+	s.orders[orderNumber] = &order{
+		seq:           s.seq,
+		userID:        userID,
+		number:        orderNumber,
+		status:        accStatus,
+		accrual:       accrual,
+		uploadedAt:    now,
+		nextAttemptAt: &now,
+	}
+
+	if accStatus == "PROCESSED" {
+		s.post(userID, models.EntryAccrual, orderNumber, accrual)
+	}
+	return nil
+}
+
+// Функция запрос списания баллов/сумм по пользователь с проверкой остатка
+func (s *Store) AddWithdraw(ctx context.Context, userID int, orderNumber string, sum models.Money) error {
+	if sum <= 0 {
+		return errorsapi.ErrorRegInfo
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.available(userID) < sum {
+		return errorsapi.ErrorInsufficientFunds
+	}
+
+	if _, ok := s.withdrawn[orderNumber]; ok {
+		return errorsapi.ErrorConflict
+	}
+	// заказ с действующим резервом списывается только подтверждением резерва
+	if h, ok := s.holds[orderNumber]; ok && h.status == models.HoldHeld {
+		return errorsapi.ErrorConflict
+	}
+
+	w := &withdraw{
+		userID:      userID,
+		order:       orderNumber,
+		sum:         sum,
+		processedAt: s.now(),
+	}
+	s.withdrawals = append(s.withdrawals, w)
+	s.withdrawn[orderNumber] = w
+
+	s.post(userID, models.EntryWithdrawal, orderNumber, -sum)
+	return nil
+}
+
+// Функция запрос на получение всех списаний баллов/сумм
+func (s *Store) GetWithdrawals(ctx context.Context, userID int) ([]models.WithdrawGetDB, error) {
+	res := make([]models.WithdrawGetDB, 0)
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, w := range s.withdrawals {
+		if w.userID == userID {
+			res = append(res, w.model())
+		}
+	}
+	return res, nil
+}
+
+// Хранилищу в памяти освобождение ресурсов не требуется
+func (s *Store) Close() error {
+	return nil
+}
+
+// Функция создания сессии пользователя с хэшем refresh токена
+func (s *Store) CreateSession(ctx context.Context, userID int, sessionID, refreshHash string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[sessionID]; ok {
+		return errorsapi.ErrorConflict
+	}
+	s.sessions[sessionID] = &session{userID: userID, refreshHash: refreshHash, expiresAt: expiresAt}
+	return nil
+}
+
+// Функция замены refresh токена сессии, повторное предъявление токена отзывает сессию
+func (s *Store) RotateSession(ctx context.Context, sessionID, refreshHash, newHash string, expiresAt time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok || !s.active(sess) {
+		return 0, errorsapi.ErrorSessionInvalid
+	}
+	if sess.refreshHash != refreshHash {
+		sess.revoked = true
+		return 0, errorsapi.ErrorSessionInvalid
+	}
+	sess.refreshHash = newHash
+	sess.expiresAt = expiresAt
+	return sess.userID, nil
+}
+
+// Функция отзыва сессии пользователя
+func (s *Store) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess, ok := s.sessions[sessionID]; ok && sess.userID == userID {
+		sess.revoked = true
+	}
+	return nil
+}
+
+// Функция отзыва всех сессий пользователя
+func (s *Store) RevokeSessions(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sess := range s.sessions {
+		if sess.userID == userID {
+			sess.revoked = true
+		}
+	}
+	return nil
+}
+
+// Функция проверки, что сессия не отозвана и не истекла
+func (s *Store) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	return ok && s.active(sess), nil
+}
+
+// Функция проверки действительности сессии
+func (s *Store) active(sess *session) bool {
+	return !sess.revoked && sess.expiresAt.After(s.now())
+}
+
+// Функция проводки по счёту пользователя, повторная проводка игнорируется
+func (s *Store) post(userID int, entryType, reference string, amount models.Money) {
+	key := entryType + ":" + reference
+	if amount == 0 || s.posted[key] {
+		return
+	}
+	s.posted[key] = true
+	s.entries = append(s.entries, &entry{
+		userID:    userID,
+		entryType: entryType,
+		reference: reference,
+		amount:    amount,
+		createdAt: s.now(),
+	})
+
+	acc := s.account(userID)
+	acc.balance += amount
+	if entryType == models.EntryWithdrawal || entryType == models.EntryReversal {
+		acc.withdrawn -= amount
+	}
+}
+
+// Функция захвата (аренды) необработанных заказов
+func (s *Store) LeaseOrders(ctx context.Context, limit int, lease time.Duration) ([]string, error) {
+	res := make([]string, 0)
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	ready := make([]*order, 0)
+	for _, o := range s.orders {
+		if isFinal(o.status) || o.nextAttemptAt == nil || o.nextAttemptAt.After(now) || o.lockedUntil.After(now) {
+			continue
+		}
+		ready = append(ready, o)
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		if !ready[i].nextAttemptAt.Equal(*ready[j].nextAttemptAt) {
+			return ready[i].nextAttemptAt.Before(*ready[j].nextAttemptAt)
+		}
+		return ready[i].seq < ready[j].seq
+	})
+
+	for _, o := range ready {
+		if len(res) == limit {
+			break
+		}
+		o.lockedUntil = now.Add(lease)
+		res = append(res, o.number)
+	}
+	return res, nil
+}
+
+// Функция переноса заказа на повторную обработку с экспоненциальной задержкой
+func (s *Store) RetryOrder(ctx context.Context, orderNumber string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderNumber]
+	if !ok {
+		return fmt.Errorf("%s %w", errorsapi.ErrorExecQuery.Error(), errNotFound)
+	}
+	s.retry(o)
+	return nil
+}
+
+// Функция возврата захваченных заказов в очередь без учёта попытки
+func (s *Store) ReleaseOrders(ctx context.Context, delay time.Duration, orders ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := s.now().Add(delay)
+	for _, number := range orders {
+		o, ok := s.orders[number]
+		if !ok {
+			continue
+		}
+		o.lockedUntil = time.Time{}
+		if o.nextAttemptAt != nil && o.nextAttemptAt.Before(next) {
+			o.nextAttemptAt = &next
+		}
+	}
+	return nil
+}
+
+// Функция обновления состояния заказа по данным accrual системы,
+// заказы с неокончательным статусом опрашиваются повторно через PollInterval без учёта попытки
+func (s *Store) UpdateNotProcessedOrders(ctx context.Context, orderNumber, status string, accrual models.Money) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderNumber]
+	if !ok {
+		return fmt.Errorf("%s %w", errorsapi.ErrorExecQuery.Error(), errNotFound)
+	}
+	// окончательный статус не изменяется повторным или запоздавшим ответом
+	if isFinal(o.status) {
+		return nil
+	}
+	o.status = status
+	o.accrual = accrual
+	o.lockedUntil = time.Time{}
+	o.attempts = 0
+
+	if !isFinal(status) {
+		next := s.now().Add(models.PollInterval)
+		o.nextAttemptAt = &next
+	}
+	if status == "PROCESSED" {
+		s.post(o.userID, models.EntryAccrual, o.number, accrual)
+	}
+	return nil
+}
+
+// Функция расчёта следующей попытки так же, как в db.Store.RetryOrder
+func (s *Store) retry(o *order) {
+	delay := time.Duration(math.Min(
+		float64(models.RetryBaseDelay)*math.Pow(2, float64(o.attempts)),
+		float64(models.RetryMaxDelay)))
+
+	if o.attempts < models.RetryMaxAttempts {
+		o.attempts++
+	}
+	o.lockedUntil = time.Time{}
+	next := s.now().Add(delay)
+	o.nextAttemptAt = &next
+}
+
+// Функция проверки окончательного статуса заказа
+func isFinal(status string) bool {
+	return status == "INVALID" || status == "PROCESSED"
+}
@@ -0,0 +1,17 @@
+package memory_test
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/closable/go-yandex-loyalty/internal/handlers"
+	"github.com/closable/go-yandex-loyalty/internal/memory"
+	"github.com/closable/go-yandex-loyalty/internal/storetest"
+)
+
+func TestStore_Contract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) handlers.Sourcer {
+		return memory.New(memory.WithPasswordCost(bcrypt.MinCost))
+	})
+}
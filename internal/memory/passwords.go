@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+)
+
+// Токен сброса пароля
+type passwordReset struct {
+	userID    int
+	expiresAt time.Time
+	used      bool
+}
+
+// Функция смены пароля пользователя после проверки текущего пароля
+func (s *Store) ChangePassword(ctx context.Context, userID int, current, next string) error {
+	if len(next) == 0 {
+		return errorsapi.ErrorRegInfo
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	u := s.userByID(userID)
+	if u == nil || !u.status {
+		s.mu.Unlock()
+		return errorsapi.ErrorWrongPassword
+	}
+	oldHash := u.passw
+	s.mu.Unlock()
+
+	// проверка и хэширование пароля выполняются без блокировки хранилища
+	if ok, _ := s.hasher.Verify(oldHash, current); !ok {
+		return errorsapi.ErrorWrongPassword
+	}
+	hash, err := s.hasher.Hash(next)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// пароль изменён параллельным запросом после проверки
+	if u.passw != oldHash {
+		return errorsapi.ErrorConflict
+	}
+	u.passw = hash
+	return nil
+}
+
+// Функция сохранения хэша токена сброса пароля пользователя login, прежние токены пользователя
+// перестают действовать. Для неизвестного или заблокированного пользователя возвращает 0
+func (s *Store) CreatePasswordReset(ctx context.Context, login, tokenHash string, expiresAt time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[login]
+	if !ok || !u.status {
+		return 0, nil
+	}
+	for _, reset := range s.resets {
+		if reset.userID == u.id {
+			reset.used = true
+		}
+	}
+	s.resets[tokenHash] = &passwordReset{userID: u.id, expiresAt: expiresAt}
+	return u.id, nil
+}
+
+// Функция установки нового пароля по одноразовому токену сброса, возвращает ID пользователя.
+// Сброс пароля снимает блокировку входа пользователя
+func (s *Store) ResetPassword(ctx context.Context, tokenHash, pass string) (int, error) {
+	if len(pass) == 0 {
+		return 0, errorsapi.ErrorRegInfo
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	hash, err := s.hasher.Hash(pass)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset, ok := s.resets[tokenHash]
+	if !ok || reset.used || !reset.expiresAt.After(s.now()) {
+		return 0, errorsapi.ErrorResetInvalid
+	}
+	reset.used = true
+
+	u := s.userByID(reset.userID)
+	if u == nil || !u.status {
+		return 0, errorsapi.ErrorResetInvalid
+	}
+	u.passw = hash
+	u.failures = attempts{}
+	return u.id, nil
+}
+
+// Функция поиска пользователя по ID, вызывается под блокировкой хранилища
+func (s *Store) userByID(userID int) *user {
+	for _, u := range s.users {
+		if u.id == userID {
+			return u
+		}
+	}
+	return nil
+}
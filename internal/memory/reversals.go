@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Функция отмены списания по номеру заказа: баллы возвращаются на счёт пользователя
+// проводкой REVERSAL, исходное списание сохраняется с отметкой об отмене.
+// Для уже отменённого списания возвращает его и ErrorInfoFound
+func (s *Store) ReverseWithdraw(ctx context.Context, orderNumber, reversedBy, reason string) (models.WithdrawGetDB, error) {
+	if err := ctx.Err(); err != nil {
+		return models.WithdrawGetDB{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.withdrawn[orderNumber]
+	if !ok {
+		return models.WithdrawGetDB{}, errorsapi.ErrorWithdrawNotFound
+	}
+	if !w.reversedAt.IsZero() {
+		return w.model(), errorsapi.ErrorInfoFound
+	}
+
+	w.reversedAt = s.now()
+	w.reversedBy = reversedBy
+	w.reversalReason = reason
+	s.post(w.userID, models.EntryReversal, orderNumber, w.sum)
+	return w.model(), nil
+}
+
+// Функция преобразования списания в модель приложения
+func (w *withdraw) model() models.WithdrawGetDB {
+	res := models.WithdrawGetDB{
+		Order:       w.order,
+		Sum:         w.sum,
+		ProcessedAt: formatTime(w.processedAt),
+	}
+	if !w.reversedAt.IsZero() {
+		res.ReversedAt = formatTime(w.reversedAt)
+	}
+	return res
+}
@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"context"
+
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Функция получения роли пользователя
+func (s *Store) UserRole(ctx context.Context, userID int) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByID(userID)
+	if u == nil {
+		return "", errorsapi.ErrorUserNotFound
+	}
+	return u.role, nil
+}
+
+// Функция назначения роли пользователю
+func (s *Store) SetUserRole(ctx context.Context, userID int, role string) error {
+	if !models.ValidRole(role) {
+		return errorsapi.ErrorRegInfo
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByID(userID)
+	if u == nil {
+		return errorsapi.ErrorUserNotFound
+	}
+	u.role = role
+	return nil
+}
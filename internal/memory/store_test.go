@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/passwd"
+	"github.com/closable/go-yandex-loyalty/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestStore_LoginUpgradesLegacyHash(t *testing.T) {
+	ctx := context.Background()
+	s := New(WithPasswordCost(bcrypt.MinCost))
+	s.users["legacy"] = &user{id: 1, name: "legacy", passw: passwd.Legacy("secret"), status: true}
+
+	if userID, err := s.Login(ctx, "legacy", "wrong"); err != nil || userID != 0 {
+		t.Errorf("Login() wrong password = %d, %v, want 0", userID, err)
+	}
+	if s.users["legacy"].passw != passwd.Legacy("secret") {
+		t.Errorf("password hash changed after failed login")
+	}
+	if userID, err := s.Login(ctx, "legacy", "secret"); err != nil || userID != 1 {
+		t.Fatalf("Login() = %d, %v, want 1", userID, err)
+	}
+	if hash := s.users["legacy"].passw; !strings.HasPrefix(hash, "$2") {
+		t.Errorf("password hash = %s, want bcrypt", hash)
+	}
+	if userID, err := s.Login(ctx, "legacy", "secret"); err != nil || userID != 1 {
+		t.Errorf("Login() after upgrade = %d, %v, want 1", userID, err)
+	}
+}
+
+func TestStore_PollsPendingOrders(t *testing.T) {
+	ctx := context.Background()
+	s := New(WithPasswordCost(bcrypt.MinCost))
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	if err := s.AddOrder(ctx, 1, "12345678903", "NEW", 0); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+	// расчёт по заказу идёт дольше, чем допускает лимит попыток при сбоях
+	for i := 0; i <= models.RetryMaxAttempts; i++ {
+		now = now.Add(models.PollInterval)
+		if orders, err := s.LeaseOrders(ctx, 10, time.Minute); err != nil || len(orders) != 1 {
+			t.Fatalf("LeaseOrders() poll %d = %v, %v, want pending order", i, orders, err)
+		}
+		if err := s.UpdateNotProcessedOrders(ctx, "12345678903", "PROCESSING", 0); err != nil {
+			t.Fatalf("UpdateNotProcessedOrders() error = %v", err)
+		}
+	}
+	if o := s.orders["12345678903"]; o.attempts != 0 || o.nextAttemptAt == nil {
+		t.Errorf("order attempts = %d, next attempt = %v, want polling without attempts", o.attempts, o.nextAttemptAt)
+	}
+}
+
+func TestStore_RetryOrderAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	s := New(WithPasswordCost(bcrypt.MinCost))
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	if err := s.AddOrder(ctx, 1, "12345678903", "NEW", 0); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+	for i := 0; i < models.RetryMaxAttempts+5; i++ {
+		if err := s.RetryOrder(ctx, "12345678903"); err != nil {
+			t.Fatalf("RetryOrder() error = %v", err)
+		}
+	}
+
+	// после исчерпания попыток заказ остаётся в очереди с максимальной задержкой
+	o := s.orders["12345678903"]
+	if o.attempts != models.RetryMaxAttempts || o.nextAttemptAt == nil || !o.nextAttemptAt.Equal(now.Add(models.RetryMaxDelay)) {
+		t.Fatalf("order attempts = %d, next attempt = %v, want %d and %v", o.attempts, o.nextAttemptAt, models.RetryMaxAttempts, now.Add(models.RetryMaxDelay))
+	}
+	if orders, _ := s.LeaseOrders(ctx, 10, time.Minute); len(orders) != 0 {
+		t.Errorf("LeaseOrders() = %v, want empty before delay", orders)
+	}
+	now = now.Add(models.RetryMaxDelay)
+	if orders, err := s.LeaseOrders(ctx, 10, time.Minute); err != nil || len(orders) != 1 {
+		t.Errorf("LeaseOrders() = %v, %v, want order after max delay", orders, err)
+	}
+}
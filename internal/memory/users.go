@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Функция получения логина пользователя
+func (s *Store) UserLogin(ctx context.Context, userID int) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByID(userID)
+	if u == nil {
+		return "", errorsapi.ErrorUserNotFound
+	}
+	return u.name, nil
+}
+
+// Функция получения списка пользователей, логин которых содержит query (без учёта регистра),
+// упорядоченного по ID
+func (s *Store) ListUsers(ctx context.Context, query string, limit, offset int) ([]models.UserDB, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query = strings.ToLower(query)
+	res := make([]models.UserDB, 0)
+	for _, u := range s.users {
+		if !strings.Contains(strings.ToLower(u.name), query) {
+			continue
+		}
+		user := models.UserDB{
+			ID:            u.id,
+			Login:         u.name,
+			Role:          u.role,
+			Blocked:       !u.status,
+			BlockedReason: u.blockedReason,
+		}
+		if !u.blockedAt.IsZero() {
+			user.BlockedAt = formatTime(u.blockedAt)
+		}
+		res = append(res, user)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+
+	if offset >= len(res) {
+		return res[:0], nil
+	}
+	res = res[offset:]
+	if limit < len(res) {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// Функция блокировки пользователя с указанием причины,
+// сессии пользователя отзываются под той же блокировкой
+func (s *Store) BlockUser(ctx context.Context, userID int, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByID(userID)
+	if u == nil {
+		return errorsapi.ErrorUserNotFound
+	}
+	u.status = false
+	u.blockedReason = reason
+	u.blockedAt = s.now()
+	for _, sess := range s.sessions {
+		if sess.userID == userID {
+			sess.revoked = true
+		}
+	}
+	return nil
+}
+
+// Функция снятия блокировки пользователя
+func (s *Store) UnblockUser(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByID(userID)
+	if u == nil {
+		return errorsapi.ErrorUserNotFound
+	}
+	u.status = true
+	u.blockedReason = ""
+	u.blockedAt = time.Time{}
+	return nil
+}
@@ -0,0 +1,261 @@
+// Пакет версионных миграций схемы СУБД.
+// Миграции встроены в бинарный файл (каталог sql) и именуются по шаблону
+// NNNN_name.up.sql / NNNN_name.down.sql, применённые версии хранятся в таблице schema_migrations.
+// Все операции выполняются под advisory lock, поэтому несколько экземпляров
+// приложения могут запускать миграции одновременно
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Ключ advisory lock, под которым выполняются миграции
+const lockKey = 20240410
+
+// Структура миграции
+type Migration struct {
+	// Версия (номер файла)
+	Version int
+	// Наименование
+	Name string
+	// SQL применения
+	Up string
+	// SQL отката
+	Down string
+}
+
+// Структура состояния миграции
+type State struct {
+	Migration
+	// Время применения, nil если миграция не применена
+	AppliedAt *time.Time
+}
+
+// Функция получения списка встроенных миграций в порядке возрастания версий
+func List() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := splitName(name)
+		if !ok {
+			return nil, fmt.Errorf("migration %s: invalid file name", name)
+		}
+
+		num, title, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version %w", name, err)
+		}
+
+		body, err := files.ReadFile(path.Join("sql", name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if m.Name != title {
+			return nil, fmt.Errorf("migration %d: different names %s and %s", version, m.Name, title)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d: up and down files are required", m.Version)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+
+	return res, nil
+}
+
+// Функция разбора имени файла миграции на основу и направление (up/down)
+func splitName(name string) (string, string, bool) {
+	for _, direction := range []string{"up", "down"} {
+		if base, ok := strings.CutSuffix(name, "."+direction+".sql"); ok {
+			return base, direction, true
+		}
+	}
+	return "", "", false
+}
+
+// Функция применения всех неприменённых миграций, возвращает количество применённых
+func Up(ctx context.Context, db *sql.DB) (int, error) {
+	migrations, err := List()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := versions[m.Version]; ok {
+				continue
+			}
+			err = apply(ctx, conn, m.Up,
+				`insert into schema_migrations (version, name, applied_at) values ($1, $2, now())`, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s up: %w", m.Version, m.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Функция отката последней применённой миграции, возвращает её версию (0, если откатывать нечего)
+func Down(ctx context.Context, db *sql.DB) (int, error) {
+	migrations, err := List()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if _, ok := versions[m.Version]; !ok {
+				continue
+			}
+			err = apply(ctx, conn, m.Down, `delete from schema_migrations where version = $1`, m.Version)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s down: %w", m.Version, m.Name, err)
+			}
+			reverted = m.Version
+			return nil
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Функция получения состояния всех встроенных миграций
+func Status(ctx context.Context, db *sql.DB) ([]State, error) {
+	migrations, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]State, 0, len(migrations))
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := State{Migration: m}
+			if at, ok := versions[m.Version]; ok {
+				state.AppliedAt = &at
+			}
+			res = append(res, state)
+		}
+		return nil
+	})
+
+	return res, err
+}
+
+// Функция выполнения действия на выделенном соединении под advisory lock
+func withLock(ctx context.Context, db *sql.DB, action func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `select pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("acquire migrations lock: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `select pg_advisory_unlock($1)`, lockKey)
+
+	sqlTable := `
+	create table if not exists schema_migrations
+	(
+		version bigint NOT NULL,
+		name character varying(255) NOT NULL,
+		applied_at timestamp with time zone NOT NULL DEFAULT now(),
+		CONSTRAINT schema_migrations_pkey PRIMARY KEY (version)
+	)`
+	if _, err = conn.ExecContext(ctx, sqlTable); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return action(conn)
+}
+
+// Функция получения применённых версий и времени их применения
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `select version, applied_at from schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		res[version] = at
+	}
+	return res, rows.Err()
+}
+
+// Функция выполнения SQL миграции и записи версии в одной транзакции
+func apply(ctx context.Context, conn *sql.Conn, body, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	migrations, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+
+	for i, m := range migrations {
+		// версии идут подряд, начиная с 1
+		if m.Version != i+1 {
+			t.Errorf("migration %s version = %d, want %d", m.Name, m.Version, i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %04d_%s has empty up or down", m.Version, m.Name)
+		}
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		base      string
+		direction string
+		ok        bool
+	}{
+		{name: "up", file: "0001_init.up.sql", base: "0001_init", direction: "up", ok: true},
+		{name: "down", file: "0002_orders_queue.down.sql", base: "0002_orders_queue", direction: "down", ok: true},
+		{name: "invalid", file: "0003_ledger.sql", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, direction, ok := splitName(tt.file)
+			if base != tt.base || direction != tt.direction || ok != tt.ok {
+				t.Errorf("splitName() = %s %s %v, want %s %s %v", base, direction, ok, tt.base, tt.direction, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS ya.withdrawals;
+DROP TABLE IF EXISTS ya.orders;
+DROP TABLE IF EXISTS ya.users;
+DROP SCHEMA IF EXISTS ya;
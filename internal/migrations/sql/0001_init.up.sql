@@ -0,0 +1,31 @@
+CREATE SCHEMA IF NOT EXISTS ya;
+
+CREATE TABLE IF NOT EXISTS ya.users
+(
+	user_id bigserial NOT NULL,
+	user_name character varying(255) COLLATE pg_catalog."default" NOT NULL,
+	user_passw character varying(100) COLLATE pg_catalog."default" NOT NULL,
+	status boolean DEFAULT false,
+	CONSTRAINT user_pkey PRIMARY KEY (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS ya.orders
+(
+	id_order bigserial NOT NULL,
+	user_id integer NOT NULL,
+	order_number character varying(20) COLLATE pg_catalog."default" NOT NULL,
+	status character varying(20) COLLATE pg_catalog."default" NOT NULL,
+	accrual numeric(10,2) DEFAULT 0.0,
+	uploaded_at timestamp with time zone,
+	CONSTRAINT orders_pkey PRIMARY KEY (id_order)
+);
+
+CREATE TABLE IF NOT EXISTS ya.withdrawals
+(
+	id_withdraw bigserial NOT NULL,
+	user_id integer NOT NULL,
+	order_number character varying(20) COLLATE pg_catalog."default" NOT NULL,
+	sum numeric(10,2) DEFAULT 0.0,
+	processed_at timestamp with time zone,
+	CONSTRAINT withdrawals_pkey PRIMARY KEY (id_withdraw)
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS ya.orders_queue_idx;
+
+ALTER TABLE ya.orders
+	DROP COLUMN IF EXISTS locked_until,
+	DROP COLUMN IF EXISTS next_attempt_at,
+	DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,10 @@
+ALTER TABLE ya.orders
+	ADD COLUMN IF NOT EXISTS attempts integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS next_attempt_at timestamp with time zone DEFAULT now(),
+	ADD COLUMN IF NOT EXISTS locked_until timestamp with time zone;
+
+UPDATE ya.orders SET next_attempt_at = now()
+	WHERE next_attempt_at IS NULL AND attempts = 0 AND status NOT IN ('INVALID', 'PROCESSED');
+
+CREATE INDEX IF NOT EXISTS orders_queue_idx ON ya.orders (next_attempt_at)
+	WHERE status NOT IN ('INVALID', 'PROCESSED');
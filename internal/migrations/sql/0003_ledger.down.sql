@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS ledger_immutable ON ya.ledger;
+DROP FUNCTION IF EXISTS ya.ledger_immutable();
+DROP TABLE IF EXISTS ya.ledger;
+DROP SEQUENCE IF EXISTS ya.ledger_posting_seq;
+DROP TABLE IF EXISTS ya.accounts;
@@ -0,0 +1,74 @@
+CREATE TABLE IF NOT EXISTS ya.accounts
+(
+	user_id bigint NOT NULL,
+	balance numeric(12,2) NOT NULL DEFAULT 0.0,
+	withdrawn numeric(12,2) NOT NULL DEFAULT 0.0,
+	updated_at timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT accounts_pkey PRIMARY KEY (user_id)
+);
+
+CREATE SEQUENCE IF NOT EXISTS ya.ledger_posting_seq;
+
+CREATE TABLE IF NOT EXISTS ya.ledger
+(
+	id_entry bigserial NOT NULL,
+	posting_id bigint NOT NULL,
+	account character varying(50) COLLATE pg_catalog."default" NOT NULL,
+	user_id bigint,
+	direction character varying(6) COLLATE pg_catalog."default" NOT NULL,
+	amount numeric(10,2) NOT NULL,
+	entry_type character varying(20) COLLATE pg_catalog."default" NOT NULL,
+	reference character varying(64) COLLATE pg_catalog."default" NOT NULL,
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT ledger_pkey PRIMARY KEY (id_entry),
+	CONSTRAINT ledger_entry_uq UNIQUE (entry_type, reference, account),
+	CONSTRAINT ledger_direction_chk CHECK (direction IN ('DEBIT', 'CREDIT')),
+	CONSTRAINT ledger_amount_chk CHECK (amount > 0)
+);
+
+CREATE OR REPLACE FUNCTION ya.ledger_immutable() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+	RAISE EXCEPTION 'ya.ledger entries are immutable';
+END
+$$;
+
+DROP TRIGGER IF EXISTS ledger_immutable ON ya.ledger;
+CREATE TRIGGER ledger_immutable BEFORE UPDATE OR DELETE ON ya.ledger
+	FOR EACH ROW EXECUTE FUNCTION ya.ledger_immutable();
+
+-- перенос в журнал начислений и списаний, выполненных до его появления
+WITH src AS (
+	SELECT nextval('ya.ledger_posting_seq') posting_id, user_id, entry_type, reference, amount, created_at
+	FROM (
+		SELECT o.user_id, 'ACCRUAL' entry_type, o.order_number reference, o.accrual amount,
+			coalesce(o.uploaded_at, now()) created_at
+		FROM ya.orders o
+		WHERE o.status = 'PROCESSED' AND o.accrual > 0
+		UNION ALL
+		SELECT w.user_id, 'WITHDRAWAL', w.order_number, w.sum, coalesce(w.processed_at, now())
+		FROM ya.withdrawals w
+		WHERE w.sum > 0
+	) e
+	WHERE NOT EXISTS (SELECT 1 FROM ya.ledger l WHERE l.entry_type = e.entry_type AND l.reference = e.reference)
+)
+INSERT INTO ya.ledger (posting_id, account, user_id, direction, amount, entry_type, reference, created_at)
+SELECT posting_id, 'user:' || user_id, user_id,
+	CASE WHEN entry_type = 'ACCRUAL' THEN 'CREDIT' ELSE 'DEBIT' END,
+	amount, entry_type, reference, created_at
+FROM src
+UNION ALL
+SELECT posting_id,
+	CASE WHEN entry_type = 'ACCRUAL' THEN 'system:accruals' ELSE 'system:withdrawals' END, NULL,
+	CASE WHEN entry_type = 'ACCRUAL' THEN 'DEBIT' ELSE 'CREDIT' END,
+	amount, entry_type, reference, created_at
+FROM src;
+
+INSERT INTO ya.accounts (user_id, balance, withdrawn)
+SELECT l.user_id,
+	sum(CASE WHEN l.direction = 'CREDIT' THEN l.amount ELSE -l.amount END),
+	sum(CASE WHEN l.entry_type = 'WITHDRAWAL' THEN l.amount ELSE 0 END)
+FROM ya.ledger l
+WHERE l.user_id IS NOT NULL
+GROUP BY l.user_id
+ON CONFLICT (user_id) DO NOTHING;
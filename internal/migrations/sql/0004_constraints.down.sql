@@ -0,0 +1,13 @@
+ALTER TABLE ya.ledger DROP CONSTRAINT IF EXISTS ledger_user_fk;
+
+ALTER TABLE ya.accounts DROP CONSTRAINT IF EXISTS accounts_user_fk;
+
+ALTER TABLE ya.withdrawals
+	DROP CONSTRAINT IF EXISTS withdrawals_user_fk,
+	DROP CONSTRAINT IF EXISTS withdrawals_number_uq;
+
+ALTER TABLE ya.orders
+	DROP CONSTRAINT IF EXISTS orders_user_fk,
+	DROP CONSTRAINT IF EXISTS orders_number_uq;
+
+ALTER TABLE ya.users DROP CONSTRAINT IF EXISTS users_name_uq;
@@ -0,0 +1,70 @@
+-- проверка данных перед добавлением ограничений: дубликаты и записи без пользователя
+-- не удаляются автоматически (начисления и списания влияют на баланс), миграция
+-- прерывается с перечнем строк, которые нужно исправить вручную
+DO $$
+DECLARE
+	bad text;
+BEGIN
+	SELECT string_agg(format('%s (user_id %s)', user_name, ids), '; ') INTO bad
+	FROM (
+		SELECT user_name, string_agg(user_id::text, ',' ORDER BY user_id) ids
+		FROM ya.users GROUP BY user_name HAVING count(*) > 1
+	) d;
+	IF bad IS NOT NULL THEN
+		RAISE EXCEPTION 'ya.users duplicate user_name: %', bad;
+	END IF;
+
+	SELECT string_agg(format('%s (id_order %s)', order_number, ids), '; ') INTO bad
+	FROM (
+		SELECT order_number, string_agg(id_order::text, ',' ORDER BY id_order) ids
+		FROM ya.orders GROUP BY order_number HAVING count(*) > 1
+	) d;
+	IF bad IS NOT NULL THEN
+		RAISE EXCEPTION 'ya.orders duplicate order_number: %', bad;
+	END IF;
+
+	SELECT string_agg(format('%s (id_withdraw %s)', order_number, ids), '; ') INTO bad
+	FROM (
+		SELECT order_number, string_agg(id_withdraw::text, ',' ORDER BY id_withdraw) ids
+		FROM ya.withdrawals GROUP BY order_number HAVING count(*) > 1
+	) d;
+	IF bad IS NOT NULL THEN
+		RAISE EXCEPTION 'ya.withdrawals duplicate order_number: %', bad;
+	END IF;
+
+	SELECT string_agg(format('%s.%s user_id %s', t.tbl, t.id, t.user_id), '; ') INTO bad
+	FROM (
+		SELECT 'ya.orders' tbl, o.id_order id, o.user_id FROM ya.orders o
+		WHERE NOT EXISTS (SELECT 1 FROM ya.users u WHERE u.user_id = o.user_id)
+		UNION ALL
+		SELECT 'ya.withdrawals', w.id_withdraw, w.user_id FROM ya.withdrawals w
+		WHERE NOT EXISTS (SELECT 1 FROM ya.users u WHERE u.user_id = w.user_id)
+		UNION ALL
+		SELECT 'ya.accounts', a.user_id, a.user_id FROM ya.accounts a
+		WHERE NOT EXISTS (SELECT 1 FROM ya.users u WHERE u.user_id = a.user_id)
+		UNION ALL
+		SELECT 'ya.ledger', l.id_entry, l.user_id FROM ya.ledger l
+		WHERE l.user_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM ya.users u WHERE u.user_id = l.user_id)
+	) t;
+	IF bad IS NOT NULL THEN
+		RAISE EXCEPTION 'rows reference missing users: %', bad;
+	END IF;
+END
+$$;
+
+ALTER TABLE ya.users
+	ADD CONSTRAINT users_name_uq UNIQUE (user_name);
+
+ALTER TABLE ya.orders
+	ADD CONSTRAINT orders_number_uq UNIQUE (order_number),
+	ADD CONSTRAINT orders_user_fk FOREIGN KEY (user_id) REFERENCES ya.users (user_id);
+
+ALTER TABLE ya.withdrawals
+	ADD CONSTRAINT withdrawals_number_uq UNIQUE (order_number),
+	ADD CONSTRAINT withdrawals_user_fk FOREIGN KEY (user_id) REFERENCES ya.users (user_id);
+
+ALTER TABLE ya.accounts
+	ADD CONSTRAINT accounts_user_fk FOREIGN KEY (user_id) REFERENCES ya.users (user_id);
+
+ALTER TABLE ya.ledger
+	ADD CONSTRAINT ledger_user_fk FOREIGN KEY (user_id) REFERENCES ya.users (user_id);
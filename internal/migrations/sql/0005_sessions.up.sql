@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS ya.sessions
+(
+	session_id character varying(64) NOT NULL,
+	user_id integer NOT NULL,
+	refresh_hash character varying(64) NOT NULL,
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	rotated_at timestamp with time zone,
+	expires_at timestamp with time zone NOT NULL,
+	revoked_at timestamp with time zone,
+	CONSTRAINT sessions_pkey PRIMARY KEY (session_id),
+	CONSTRAINT sessions_user_fk FOREIGN KEY (user_id) REFERENCES ya.users (user_id)
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_active_idx
+	ON ya.sessions (user_id) WHERE revoked_at IS NULL;
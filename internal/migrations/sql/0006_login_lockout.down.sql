@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS ya.login_attempts;
+
+ALTER TABLE ya.users
+	DROP COLUMN IF EXISTS locked_until,
+	DROP COLUMN IF EXISTS last_failed_at,
+	DROP COLUMN IF EXISTS failed_logins;
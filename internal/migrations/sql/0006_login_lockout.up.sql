@@ -0,0 +1,13 @@
+ALTER TABLE ya.users
+	ADD COLUMN IF NOT EXISTS failed_logins integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS last_failed_at timestamp with time zone,
+	ADD COLUMN IF NOT EXISTS locked_until timestamp with time zone;
+
+CREATE TABLE IF NOT EXISTS ya.login_attempts
+(
+	ip character varying(64) NOT NULL,
+	failures integer NOT NULL DEFAULT 0,
+	last_failed_at timestamp with time zone NOT NULL,
+	locked_until timestamp with time zone,
+	CONSTRAINT login_attempts_pkey PRIMARY KEY (ip)
+);
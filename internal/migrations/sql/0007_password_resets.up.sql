@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS ya.password_resets
+(
+	token_hash character varying(64) NOT NULL,
+	user_id integer NOT NULL,
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	expires_at timestamp with time zone NOT NULL,
+	used_at timestamp with time zone,
+	CONSTRAINT password_resets_pkey PRIMARY KEY (token_hash),
+	CONSTRAINT password_resets_user_fk FOREIGN KEY (user_id) REFERENCES ya.users (user_id)
+);
+
+CREATE INDEX IF NOT EXISTS password_resets_user_idx
+	ON ya.password_resets (user_id) WHERE used_at IS NULL;
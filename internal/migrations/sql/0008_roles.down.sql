@@ -0,0 +1,3 @@
+ALTER TABLE ya.users
+	DROP CONSTRAINT IF EXISTS users_role_chk,
+	DROP COLUMN IF EXISTS user_role;
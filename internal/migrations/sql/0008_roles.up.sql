@@ -0,0 +1,3 @@
+ALTER TABLE ya.users
+	ADD COLUMN IF NOT EXISTS user_role character varying(20) NOT NULL DEFAULT 'user',
+	ADD CONSTRAINT users_role_chk CHECK (user_role IN ('user', 'support', 'admin'));
@@ -0,0 +1,3 @@
+ALTER TABLE ya.users
+	DROP COLUMN IF EXISTS blocked_at,
+	DROP COLUMN IF EXISTS blocked_reason;
@@ -0,0 +1,3 @@
+ALTER TABLE ya.users
+	ADD COLUMN IF NOT EXISTS blocked_reason text,
+	ADD COLUMN IF NOT EXISTS blocked_at timestamp with time zone;
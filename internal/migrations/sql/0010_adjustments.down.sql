@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ya.ledger_user_idx;
+DROP TABLE IF EXISTS ya.adjustments;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS ya.adjustments
+(
+	id_adjustment bigserial NOT NULL,
+	user_id bigint NOT NULL,
+	operator_id bigint NOT NULL,
+	amount numeric(10,2) NOT NULL,
+	reason_code character varying(20) COLLATE pg_catalog."default" NOT NULL,
+	comment text,
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT adjustments_pkey PRIMARY KEY (id_adjustment),
+	CONSTRAINT adjustments_user_fk FOREIGN KEY (user_id) REFERENCES ya.users (user_id),
+	CONSTRAINT adjustments_operator_fk FOREIGN KEY (operator_id) REFERENCES ya.users (user_id),
+	CONSTRAINT adjustments_amount_chk CHECK (amount <> 0),
+	CONSTRAINT adjustments_reason_chk CHECK (reason_code IN ('GOODWILL', 'FRAUD', 'CORRECTION'))
+);
+
+CREATE INDEX IF NOT EXISTS adjustments_user_idx ON ya.adjustments (user_id);
+CREATE INDEX IF NOT EXISTS ledger_user_idx ON ya.ledger (user_id, id_entry);
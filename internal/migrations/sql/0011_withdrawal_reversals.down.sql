@@ -0,0 +1,4 @@
+ALTER TABLE ya.withdrawals
+	DROP COLUMN IF EXISTS reversal_reason,
+	DROP COLUMN IF EXISTS reversed_by,
+	DROP COLUMN IF EXISTS reversed_at;
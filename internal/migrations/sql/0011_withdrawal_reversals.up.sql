@@ -0,0 +1,4 @@
+ALTER TABLE ya.withdrawals
+	ADD COLUMN IF NOT EXISTS reversed_at timestamp with time zone,
+	ADD COLUMN IF NOT EXISTS reversed_by character varying(64),
+	ADD COLUMN IF NOT EXISTS reversal_reason text;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS ya.withdraw_holds;
+
+ALTER TABLE ya.accounts
+	DROP COLUMN IF EXISTS held;
@@ -0,0 +1,20 @@
+ALTER TABLE ya.accounts
+	ADD COLUMN IF NOT EXISTS held numeric(12,2) NOT NULL DEFAULT 0.0;
+
+CREATE TABLE IF NOT EXISTS ya.withdraw_holds
+(
+	order_number character varying(20) COLLATE pg_catalog."default" NOT NULL,
+	user_id bigint NOT NULL,
+	sum numeric(10,2) NOT NULL,
+	status character varying(10) COLLATE pg_catalog."default" NOT NULL DEFAULT 'HELD',
+	created_at timestamp with time zone NOT NULL DEFAULT now(),
+	expires_at timestamp with time zone NOT NULL,
+	closed_at timestamp with time zone,
+	CONSTRAINT withdraw_holds_pkey PRIMARY KEY (order_number),
+	CONSTRAINT withdraw_holds_user_fk FOREIGN KEY (user_id) REFERENCES ya.users (user_id),
+	CONSTRAINT withdraw_holds_sum_chk CHECK (sum > 0),
+	CONSTRAINT withdraw_holds_status_chk CHECK (status IN ('HELD', 'CAPTURED', 'RELEASED', 'EXPIRED'))
+);
+
+CREATE INDEX IF NOT EXISTS withdraw_holds_expires_idx
+	ON ya.withdraw_holds (expires_at) WHERE status = 'HELD';
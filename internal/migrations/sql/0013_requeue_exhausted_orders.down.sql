@@ -0,0 +1,2 @@
+-- возвращённые в очередь заказы не исключаются повторно
+SELECT 1;
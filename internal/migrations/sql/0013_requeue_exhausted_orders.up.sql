@@ -0,0 +1,3 @@
+-- заказы, исключённые из очереди после исчерпания попыток, снова опрашиваются
+UPDATE ya.orders SET next_attempt_at = now()
+	WHERE next_attempt_at IS NULL AND status NOT IN ('INVALID', 'PROCESSED');
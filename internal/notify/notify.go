@@ -0,0 +1,34 @@
+// Пакет уведомлений пользователей.
+// Сервер передаёт уведомления через интерфейс Notifier, реализация которого доставляет их
+// пользователю (почта, мессенджер). Реализация по умолчанию записывает уведомления в журнал
+// и позволяет работать без внешних сервисов
+package notify
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Интерфейс доставки уведомлений пользователям
+type Notifier interface {
+	// Отправка токена сброса пароля пользователю login
+	PasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error
+}
+
+// Структура уведомлений через журнал приложения
+type LogNotifier struct {
+	sugar *zap.SugaredLogger
+}
+
+// Функция создания уведомлений через журнал приложения
+func NewLogNotifier(sugar *zap.SugaredLogger) *LogNotifier {
+	return &LogNotifier{sugar: sugar}
+}
+
+// Функция записи токена сброса пароля в журнал
+func (n *LogNotifier) PasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error {
+	n.sugar.Infoln("notify", "password reset", "login", login, "token", token, "expires", expiresAt.Format(time.RFC3339))
+	return nil
+}
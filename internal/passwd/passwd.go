@@ -0,0 +1,63 @@
+// Пакет хэширования паролей пользователей.
+// Пароли хэшируются bcrypt с индивидуальной солью и настраиваемой стоимостью.
+// Поддерживается проверка устаревших хэшей sha256($1)::text, которые формировались СУБД,
+// такие хэши следует заменить при следующем успешном входе пользователя
+package passwd
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Стоимость хэширования по умолчанию
+const DefaultCost = bcrypt.DefaultCost
+
+// Префикс устаревшего хэша, совпадает с представлением bytea в Postgres
+const legacyPrefix = `\x`
+
+// Структура хэширования паролей
+type Hasher struct {
+	cost int
+}
+
+// Функция создания хэширования паролей с заданной стоимостью,
+// недопустимая стоимость заменяется стоимостью по умолчанию
+func New(cost int) *Hasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = DefaultCost
+	}
+	return &Hasher{cost: cost}
+}
+
+// Функция хэширования пароля
+func (h *Hasher) Hash(pass string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Функция проверки пароля, возвращает признак совпадения
+// и признак необходимости пересчитать хэш (устаревший алгоритм или другая стоимость)
+func (h *Hasher) Verify(hash, pass string) (bool, bool) {
+	if strings.HasPrefix(hash, legacyPrefix) {
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(Legacy(pass))) == 1, true
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)); err != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err != nil || cost != h.cost
+}
+
+// Функция расчёта устаревшего хэша, совпадает с sha256($1)::text в СУБД
+func Legacy(pass string) string {
+	sum := sha256.Sum256([]byte(pass))
+	return legacyPrefix + hex.EncodeToString(sum[:])
+}
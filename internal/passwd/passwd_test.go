@@ -0,0 +1,68 @@
+package passwd
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHasher_Verify(t *testing.T) {
+	h := New(bcrypt.MinCost)
+	hash, err := h.Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	other, _ := h.Hash("secret")
+	if hash == other {
+		t.Errorf("Hash() same hash for same password, want salted")
+	}
+	stronger, _ := New(bcrypt.MinCost + 1).Hash("secret")
+
+	tests := []struct {
+		name   string
+		hash   string
+		pass   string
+		ok     bool
+		rehash bool
+	}{
+		{
+			name: "bcrypt valid",
+			hash: hash,
+			pass: "secret",
+			ok:   true,
+		},
+		{
+			name: "bcrypt wrong password",
+			hash: hash,
+			pass: "wrong",
+		},
+		{
+			name:   "bcrypt other cost",
+			hash:   stronger,
+			pass:   "secret",
+			ok:     true,
+			rehash: true,
+		},
+		{
+			name:   "legacy sha256 valid",
+			hash:   `\x2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b`,
+			pass:   "secret",
+			ok:     true,
+			rehash: true,
+		},
+		{
+			name:   "legacy sha256 wrong password",
+			hash:   Legacy("secret"),
+			pass:   "wrong",
+			rehash: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash := h.Verify(tt.hash, tt.pass)
+			if ok != tt.ok || rehash != tt.rehash {
+				t.Errorf("Verify() = %v, %v, want %v, %v", ok, rehash, tt.ok, tt.rehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,821 @@
+// Пакет общего контрактного набора тестов для реализаций handlers.Sourcer.
+// Набор запускается как для db.Store, так и для memory.Store и гарантирует
+// одинаковую семантику конфликтов, баланса и статусов заказов
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/closable/go-yandex-loyalty/internal/backgrounds"
+	errorsapi "github.com/closable/go-yandex-loyalty/internal/errors"
+	"github.com/closable/go-yandex-loyalty/internal/handlers"
+	"github.com/closable/go-yandex-loyalty/internal/lockout"
+	"github.com/closable/go-yandex-loyalty/internal/utils"
+	"github.com/closable/go-yandex-loyalty/models"
+)
+
+// Функция создания проверяемой системы хранения
+type Factory func(t *testing.T) handlers.Sourcer
+
+// Функция запуска контрактного набора тестов
+func Run(t *testing.T, newStore Factory) {
+	t.Run("Register", func(t *testing.T) { testRegister(t, newStore(t)) })
+	t.Run("Login", func(t *testing.T) { testLogin(t, newStore(t)) })
+	t.Run("Orders", func(t *testing.T) { testOrders(t, newStore(t)) })
+	t.Run("Withdraw", func(t *testing.T) { testWithdraw(t, newStore(t)) })
+	t.Run("ConcurrentWithdraw", func(t *testing.T) { testConcurrentWithdraw(t, newStore(t)) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, newStore(t)) })
+	t.Run("LoginLockout", func(t *testing.T) { testLoginLockout(t, newStore(t)) })
+	t.Run("Passwords", func(t *testing.T) { testPasswords(t, newStore(t)) })
+	t.Run("Roles", func(t *testing.T) { testRoles(t, newStore(t)) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, newStore(t)) })
+	t.Run("Adjustments", func(t *testing.T) { testAdjustments(t, newStore(t)) })
+	t.Run("Reversals", func(t *testing.T) { testReversals(t, newStore(t)) })
+	t.Run("Holds", func(t *testing.T) {
+		holds, ok := newStore(t).(holdSourcer)
+		if !ok {
+			t.Skip("store does not implement backgrounds.HoldExpirer")
+		}
+		testHolds(t, holds)
+	})
+	t.Run("Queue", func(t *testing.T) {
+		queue, ok := newStore(t).(queueSourcer)
+		if !ok {
+			t.Skip("store does not implement backgrounds.Queue")
+		}
+		testQueue(t, queue)
+	})
+}
+
+// Система хранения со снятием истёкших резервов баллов
+type holdSourcer interface {
+	handlers.Sourcer
+	backgrounds.HoldExpirer
+}
+
+// Функция проверки суммы зарезервированных баллов пользователя
+func checkHeld(t *testing.T, src handlers.Sourcer, userID int, held models.Money) {
+	t.Helper()
+	got, err := src.Balance(context.Background(), userID)
+	if err != nil || got.Held != held {
+		t.Errorf("Balance() held = %s, %v, want %s", got.Held, err, held)
+	}
+}
+
+// Система хранения с очередью синхронизации заказов
+type queueSourcer interface {
+	handlers.Sourcer
+	backgrounds.Queue
+}
+
+// Функция генерации уникального логина
+func newLogin() string {
+	return fmt.Sprintf("contract-%d-%d", time.Now().UnixNano(), rand.Intn(1000000))
+}
+
+// Функция генерации номера заказа
+func newOrder() string {
+	return utils.SillyGenerateOrderNumberLuhna(12)
+}
+
+// Функция регистрации и аутентификации нового пользователя
+func newUser(t *testing.T, src handlers.Sourcer) int {
+	t.Helper()
+	ctx := context.Background()
+	login := newLogin()
+
+	if err := src.AddUser(ctx, login, "secret"); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+	userID, err := src.Login(ctx, login, "secret")
+	if err != nil || userID == 0 {
+		t.Fatalf("Login() = %d, %v", userID, err)
+	}
+	return userID
+}
+
+// Функция проверки баланса пользователя
+func checkBalance(t *testing.T, src handlers.Sourcer, userID int, current, withdrawn models.Money) {
+	t.Helper()
+	got, err := src.Balance(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("Balance() error = %v", err)
+	}
+	if got.Current != current || got.Withdrawn != withdrawn {
+		t.Errorf("Balance() = %s / %s, want %s / %s", got.Current, got.Withdrawn, current, withdrawn)
+	}
+}
+
+func testRegister(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	login := newLogin()
+
+	if err := src.ValidateRegisterInfo(ctx, login, ""); !errors.Is(err, errorsapi.ErrorRegInfo) {
+		t.Errorf("ValidateRegisterInfo() empty password error = %v, want %v", err, errorsapi.ErrorRegInfo)
+	}
+	if err := src.ValidateRegisterInfo(ctx, login, "secret"); err != nil {
+		t.Errorf("ValidateRegisterInfo() error = %v", err)
+	}
+	if err := src.AddUser(ctx, login, "secret"); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+	if err := src.ValidateRegisterInfo(ctx, login, "secret"); !errors.Is(err, errorsapi.ErrorConflict) {
+		t.Errorf("ValidateRegisterInfo() existing user error = %v, want %v", err, errorsapi.ErrorConflict)
+	}
+	if err := src.AddUser(ctx, login, "other"); !errors.Is(err, errorsapi.ErrorConflict) {
+		t.Errorf("AddUser() existing user error = %v, want %v", err, errorsapi.ErrorConflict)
+	}
+}
+
+func testLogin(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	login := newLogin()
+
+	if err := src.AddUser(ctx, login, "secret"); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+
+	userID, err := src.Login(ctx, login, "secret")
+	if err != nil || userID == 0 {
+		t.Errorf("Login() = %d, %v, want user", userID, err)
+	}
+	if userID, err = src.Login(ctx, login, "wrong"); err != nil || userID != 0 {
+		t.Errorf("Login() wrong password = %d, %v, want 0", userID, err)
+	}
+	if userID, err = src.Login(ctx, newLogin(), "secret"); err != nil || userID != 0 {
+		t.Errorf("Login() unknown user = %d, %v, want 0", userID, err)
+	}
+	if _, err = src.Login(ctx, login, ""); !errors.Is(err, errorsapi.ErrorRegInfo) {
+		t.Errorf("Login() empty password error = %v, want %v", err, errorsapi.ErrorRegInfo)
+	}
+}
+
+func testOrders(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	owner, other := newUser(t, src), newUser(t, src)
+	first, second := newOrder(), newOrder()
+
+	if err := src.AddOrder(ctx, owner, first, "NEW", 0); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+	time.Sleep(time.Millisecond * 10)
+	if err := src.AddOrder(ctx, owner, second, "PROCESSED", 50000); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+	if err := src.AddOrder(ctx, owner, first, "NEW", 0); !errors.Is(err, errorsapi.ErrorInfoFound) {
+		t.Errorf("AddOrder() same user error = %v, want %v", err, errorsapi.ErrorInfoFound)
+	}
+	if err := src.AddOrder(ctx, other, first, "NEW", 0); !errors.Is(err, errorsapi.ErrorConflict) {
+		t.Errorf("AddOrder() other user error = %v, want %v", err, errorsapi.ErrorConflict)
+	}
+
+	orders, err := src.GetOrders(ctx, owner)
+	if err != nil {
+		t.Fatalf("GetOrders() error = %v", err)
+	}
+	if len(orders) != 2 || orders[0].OrderNumber != second || orders[1].OrderNumber != first {
+		t.Fatalf("GetOrders() = %v, want newest first %s, %s", orders, second, first)
+	}
+	if orders[0].Status != "PROCESSED" || orders[0].Accrual != 50000 || orders[0].UploadAt == "" {
+		t.Errorf("GetOrders() order = %v", orders[0])
+	}
+
+	if orders, _ = src.GetOrders(ctx, other); len(orders) != 0 {
+		t.Errorf("GetOrders() other user = %v, want empty", orders)
+	}
+
+	checkBalance(t, src, owner, 50000, 0)
+	checkBalance(t, src, other, 0, 0)
+}
+
+func testWithdraw(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	userID := newUser(t, src)
+	order := newOrder()
+
+	if err := src.AddOrder(ctx, userID, newOrder(), "PROCESSED", 50000); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+
+	for _, sum := range []models.Money{0, -10000} {
+		if err := src.AddWithdraw(ctx, userID, order, sum); !errors.Is(err, errorsapi.ErrorRegInfo) {
+			t.Errorf("AddWithdraw(%s) error = %v, want %v", sum, err, errorsapi.ErrorRegInfo)
+		}
+	}
+	checkBalance(t, src, userID, 50000, 0)
+
+	if err := src.AddWithdraw(ctx, userID, order, 70000); !errors.Is(err, errorsapi.ErrorInsufficientFunds) {
+		t.Errorf("AddWithdraw() error = %v, want %v", err, errorsapi.ErrorInsufficientFunds)
+	}
+	if err := src.AddWithdraw(ctx, userID, order, 10050); err != nil {
+		t.Fatalf("AddWithdraw() error = %v", err)
+	}
+	if err := src.AddWithdraw(ctx, userID, order, 100); !errors.Is(err, errorsapi.ErrorConflict) {
+		t.Errorf("AddWithdraw() same order error = %v, want %v", err, errorsapi.ErrorConflict)
+	}
+
+	checkBalance(t, src, userID, 39950, 10050)
+
+	withdrawals, err := src.GetWithdrawals(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetWithdrawals() error = %v", err)
+	}
+	if len(withdrawals) != 1 || withdrawals[0].Order != order || withdrawals[0].Sum != 10050 || withdrawals[0].ProcessedAt == "" {
+		t.Errorf("GetWithdrawals() = %v", withdrawals)
+	}
+}
+
+func testConcurrentWithdraw(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	userID := newUser(t, src)
+
+	if err := src.AddOrder(ctx, userID, newOrder(), "PROCESSED", 50000); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+
+	// десять параллельных списаний по 100 при балансе 500: проходят ровно пять
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		ok int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := src.AddWithdraw(ctx, userID, newOrder(), 10000)
+			if err != nil && !errors.Is(err, errorsapi.ErrorInsufficientFunds) {
+				t.Errorf("AddWithdraw() error = %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ok != 5 {
+		t.Errorf("successful withdrawals = %d, want 5", ok)
+	}
+	checkBalance(t, src, userID, 0, 50000)
+}
+
+// Функция генерации уникального идентификатора сессии
+func newSessionID() string {
+	return fmt.Sprintf("session-%d-%d", time.Now().UnixNano(), rand.Intn(1000000))
+}
+
+func testSessions(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	userID := newUser(t, src)
+	expires := time.Now().Add(time.Hour)
+
+	active := func(sessionID string, want bool) {
+		t.Helper()
+		got, err := src.SessionActive(ctx, sessionID)
+		if err != nil || got != want {
+			t.Errorf("SessionActive(%s) = %v, %v, want %v", sessionID, got, err, want)
+		}
+	}
+
+	first, second, expired := newSessionID(), newSessionID(), newSessionID()
+	for _, id := range []string{first, second} {
+		if err := src.CreateSession(ctx, userID, id, "hash-1", expires); err != nil {
+			t.Fatalf("CreateSession() error = %v", err)
+		}
+	}
+	if err := src.CreateSession(ctx, userID, expired, "hash-1", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	active(first, true)
+	active(expired, false)
+	active(newSessionID(), false)
+
+	if got, err := src.RotateSession(ctx, first, "hash-1", "hash-2", expires); err != nil || got != userID {
+		t.Fatalf("RotateSession() = %d, %v, want %d", got, err, userID)
+	}
+	if _, err := src.RotateSession(ctx, expired, "hash-1", "hash-2", expires); !errors.Is(err, errorsapi.ErrorSessionInvalid) {
+		t.Errorf("RotateSession() expired error = %v, want %v", err, errorsapi.ErrorSessionInvalid)
+	}
+	// повторное предъявление заменённого токена отзывает сессию
+	if _, err := src.RotateSession(ctx, first, "hash-1", "hash-3", expires); !errors.Is(err, errorsapi.ErrorSessionInvalid) {
+		t.Errorf("RotateSession() reused error = %v, want %v", err, errorsapi.ErrorSessionInvalid)
+	}
+	active(first, false)
+	if _, err := src.RotateSession(ctx, first, "hash-2", "hash-3", expires); !errors.Is(err, errorsapi.ErrorSessionInvalid) {
+		t.Errorf("RotateSession() revoked error = %v, want %v", err, errorsapi.ErrorSessionInvalid)
+	}
+
+	// чужой пользователь не может отозвать сессию
+	if err := src.RevokeSession(ctx, userID+1, second); err != nil {
+		t.Fatalf("RevokeSession() error = %v", err)
+	}
+	active(second, true)
+	if err := src.RevokeSession(ctx, userID, second); err != nil {
+		t.Fatalf("RevokeSession() error = %v", err)
+	}
+	active(second, false)
+
+	third, fourth := newSessionID(), newSessionID()
+	src.CreateSession(ctx, userID, third, "hash-1", expires)
+	src.CreateSession(ctx, userID, fourth, "hash-1", expires)
+	if err := src.RevokeSessions(ctx, userID); err != nil {
+		t.Fatalf("RevokeSessions() error = %v", err)
+	}
+	active(third, false)
+	active(fourth, false)
+}
+
+func testLoginLockout(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	login := newLogin()
+	if err := src.AddUser(ctx, login, "secret"); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+	ip := fmt.Sprintf("192.0.2.%d", rand.Intn(250))
+	policy := lockout.Policy{
+		Login:  lockout.Rule{Free: 1, Delay: time.Minute, MaxDelay: time.Minute, Threshold: 3, Lockout: time.Hour},
+		IP:     lockout.Rule{Threshold: 1000, Lockout: time.Hour},
+		Window: time.Hour,
+	}
+
+	lockedUntil := func(login, ip string) time.Time {
+		t.Helper()
+		until, err := src.LoginLockedUntil(ctx, login, ip)
+		if err != nil {
+			t.Fatalf("LoginLockedUntil() error = %v", err)
+		}
+		return until
+	}
+	if until := lockedUntil(login, ip); !until.IsZero() {
+		t.Fatalf("LoginLockedUntil() = %v, want zero", until)
+	}
+
+	// первая попытка бесплатная, затем задержка и блокировка
+	wants := []time.Duration{0, time.Minute, time.Hour}
+	for i, want := range wants {
+		until, err := src.AddLoginFailure(ctx, login, ip, policy)
+		if err != nil {
+			t.Fatalf("AddLoginFailure() error = %v", err)
+		}
+		if (want == 0 && !until.IsZero()) || (want != 0 && time.Until(until) < want-time.Minute/2) {
+			t.Errorf("AddLoginFailure() #%d = %v, want %v", i+1, time.Until(until), want)
+		}
+	}
+	if until := lockedUntil(login, "198.51.100.1"); time.Until(until) < time.Minute*50 {
+		t.Errorf("LoginLockedUntil() by login = %v, want lockout", time.Until(until))
+	}
+
+	if err := src.ResetLoginFailures(ctx, login); err != nil {
+		t.Fatalf("ResetLoginFailures() error = %v", err)
+	}
+	if until := lockedUntil(login, "198.51.100.1"); !until.IsZero() {
+		t.Errorf("LoginLockedUntil() after reset = %v, want zero", until)
+	}
+
+	// неизвестный логин учитывается только по IP адресу
+	policy.IP = lockout.Rule{Threshold: 1, Lockout: time.Hour}
+	if _, err := src.AddLoginFailure(ctx, newLogin(), ip, policy); err != nil {
+		t.Fatalf("AddLoginFailure() error = %v", err)
+	}
+	if until := lockedUntil(login, ip); time.Until(until) < time.Minute*50 {
+		t.Errorf("LoginLockedUntil() by IP = %v, want lockout", time.Until(until))
+	}
+}
+
+func testPasswords(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	login := newLogin()
+	if err := src.AddUser(ctx, login, "secret"); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+	userID, _ := src.Login(ctx, login, "secret")
+
+	loginAs := func(pass string, want int) {
+		t.Helper()
+		if got, err := src.Login(ctx, login, pass); err != nil || got != want {
+			t.Errorf("Login(%s) = %d, %v, want %d", pass, got, err, want)
+		}
+	}
+
+	if err := src.ChangePassword(ctx, userID, "wrong", "changed"); !errors.Is(err, errorsapi.ErrorWrongPassword) {
+		t.Errorf("ChangePassword() wrong password error = %v, want %v", err, errorsapi.ErrorWrongPassword)
+	}
+	if err := src.ChangePassword(ctx, userID, "secret", "changed"); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	loginAs("secret", 0)
+	loginAs("changed", userID)
+
+	// неизвестный пользователь не получает токен
+	if got, err := src.CreatePasswordReset(ctx, newLogin(), "unknown-hash", time.Now().Add(time.Hour)); err != nil || got != 0 {
+		t.Errorf("CreatePasswordReset() unknown user = %d, %v, want 0", got, err)
+	}
+
+	hash := func(name string) string { return fmt.Sprintf("%s-%d-%s", login, userID, name) }
+	for _, name := range []string{"first", "second"} {
+		if got, err := src.CreatePasswordReset(ctx, login, hash(name), time.Now().Add(time.Hour)); err != nil || got != userID {
+			t.Fatalf("CreatePasswordReset() = %d, %v, want %d", got, err, userID)
+		}
+	}
+	// новый запрос отменяет прежний токен
+	if _, err := src.ResetPassword(ctx, hash("first"), "reset"); !errors.Is(err, errorsapi.ErrorResetInvalid) {
+		t.Errorf("ResetPassword() replaced token error = %v, want %v", err, errorsapi.ErrorResetInvalid)
+	}
+	if got, err := src.ResetPassword(ctx, hash("second"), "reset"); err != nil || got != userID {
+		t.Fatalf("ResetPassword() = %d, %v, want %d", got, err, userID)
+	}
+	if _, err := src.ResetPassword(ctx, hash("second"), "again"); !errors.Is(err, errorsapi.ErrorResetInvalid) {
+		t.Errorf("ResetPassword() used token error = %v, want %v", err, errorsapi.ErrorResetInvalid)
+	}
+	loginAs("changed", 0)
+	loginAs("reset", userID)
+
+	src.CreatePasswordReset(ctx, login, hash("expired"), time.Now().Add(-time.Minute))
+	if _, err := src.ResetPassword(ctx, hash("expired"), "expired"); !errors.Is(err, errorsapi.ErrorResetInvalid) {
+		t.Errorf("ResetPassword() expired token error = %v, want %v", err, errorsapi.ErrorResetInvalid)
+	}
+}
+
+func testRoles(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	userID := newUser(t, src)
+
+	if role, err := src.UserRole(ctx, userID); err != nil || role != models.RoleUser {
+		t.Errorf("UserRole() = %s, %v, want %s", role, err, models.RoleUser)
+	}
+	if err := src.SetUserRole(ctx, userID, models.RoleSupport); err != nil {
+		t.Fatalf("SetUserRole() error = %v", err)
+	}
+	if role, err := src.UserRole(ctx, userID); err != nil || role != models.RoleSupport {
+		t.Errorf("UserRole() = %s, %v, want %s", role, err, models.RoleSupport)
+	}
+	if err := src.SetUserRole(ctx, userID, "root"); !errors.Is(err, errorsapi.ErrorRegInfo) {
+		t.Errorf("SetUserRole() unknown role error = %v, want %v", err, errorsapi.ErrorRegInfo)
+	}
+	if err := src.SetUserRole(ctx, userID+1000000, models.RoleAdmin); !errors.Is(err, errorsapi.ErrorUserNotFound) {
+		t.Errorf("SetUserRole() unknown user error = %v, want %v", err, errorsapi.ErrorUserNotFound)
+	}
+	if _, err := src.UserRole(ctx, userID+1000000); !errors.Is(err, errorsapi.ErrorUserNotFound) {
+		t.Errorf("UserRole() unknown user error = %v, want %v", err, errorsapi.ErrorUserNotFound)
+	}
+}
+
+func testUsers(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	prefix := newLogin()
+	ids := make([]int, 0, 3)
+	for _, name := range []string{"alpha", "beta", "Alpha_2"} {
+		login := prefix + "-" + name
+		if err := src.AddUser(ctx, login, "secret"); err != nil {
+			t.Fatalf("AddUser() error = %v", err)
+		}
+		userID, _ := src.Login(ctx, login, "secret")
+		ids = append(ids, userID)
+	}
+
+	users, err := src.ListUsers(ctx, prefix+"-ALPHA", 10, 0)
+	if err != nil || len(users) != 2 || users[0].ID != ids[0] || users[1].ID != ids[2] || users[0].Role != models.RoleUser {
+		t.Fatalf("ListUsers() = %v, %v, want alpha users", users, err)
+	}
+	if users, err = src.ListUsers(ctx, prefix, 1, 1); err != nil || len(users) != 1 || users[0].ID != ids[1] {
+		t.Errorf("ListUsers() page = %v, %v, want beta", users, err)
+	}
+	// спецсимволы шаблона ищутся как обычные символы
+	if users, err = src.ListUsers(ctx, prefix+"-%", 10, 0); err != nil || len(users) != 0 {
+		t.Errorf("ListUsers() wildcard = %v, %v, want none", users, err)
+	}
+
+	sessionID := newSessionID()
+	if err = src.CreateSession(ctx, ids[0], sessionID, "hash", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	if err = src.BlockUser(ctx, ids[0], "fraud"); err != nil {
+		t.Fatalf("BlockUser() error = %v", err)
+	}
+	if active, err := src.SessionActive(ctx, sessionID); err != nil || active {
+		t.Errorf("SessionActive() after block = %v, %v, want revoked", active, err)
+	}
+	users, _ = src.ListUsers(ctx, prefix+"-alpha", 1, 0)
+	if len(users) != 1 || !users[0].Blocked || users[0].BlockedReason != "fraud" || users[0].BlockedAt == "" {
+		t.Errorf("ListUsers() blocked = %v, want blocked user", users)
+	}
+	if _, err = src.Login(ctx, prefix+"-alpha", "secret"); !errors.Is(err, errorsapi.ErrorUserBlocked) {
+		t.Errorf("Login() blocked error = %v, want %v", err, errorsapi.ErrorUserBlocked)
+	}
+	// неверный пароль не раскрывает блокировку
+	if userID, err := src.Login(ctx, prefix+"-alpha", "wrong"); err != nil || userID != 0 {
+		t.Errorf("Login() blocked with wrong password = %d, %v, want 0", userID, err)
+	}
+
+	if err = src.UnblockUser(ctx, ids[0]); err != nil {
+		t.Fatalf("UnblockUser() error = %v", err)
+	}
+	if userID, err := src.Login(ctx, prefix+"-alpha", "secret"); err != nil || userID != ids[0] {
+		t.Errorf("Login() unblocked = %d, %v, want %d", userID, err, ids[0])
+	}
+	users, _ = src.ListUsers(ctx, prefix+"-alpha", 1, 0)
+	if len(users) != 1 || users[0].Blocked || users[0].BlockedReason != "" {
+		t.Errorf("ListUsers() unblocked = %v", users)
+	}
+
+	if err = src.BlockUser(ctx, ids[2]+1000000, "fraud"); !errors.Is(err, errorsapi.ErrorUserNotFound) {
+		t.Errorf("BlockUser() unknown user error = %v, want %v", err, errorsapi.ErrorUserNotFound)
+	}
+}
+
+func testAdjustments(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	userID, operatorID := newUser(t, src), newUser(t, src)
+	order, withdrawal := newOrder(), newOrder()
+
+	if err := src.AddOrder(ctx, userID, order, "PROCESSED", 10000); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+	if err := src.AddWithdraw(ctx, userID, withdrawal, 3000); err != nil {
+		t.Fatalf("AddWithdraw() error = %v", err)
+	}
+
+	credit, err := src.AddAdjustment(ctx, userID, operatorID, 2550, models.AdjustmentGoodwill, "late delivery")
+	if err != nil || credit == 0 {
+		t.Fatalf("AddAdjustment() credit = %d, %v", credit, err)
+	}
+	debit, err := src.AddAdjustment(ctx, userID, operatorID, -4000, models.AdjustmentFraud, "")
+	if err != nil || debit == credit {
+		t.Fatalf("AddAdjustment() debit = %d, %v", debit, err)
+	}
+	// корректировки не учитываются в сумме списаний
+	checkBalance(t, src, userID, 5550, 3000)
+
+	if _, err = src.AddAdjustment(ctx, userID, operatorID, -5551, models.AdjustmentCorrection, ""); !errors.Is(err, errorsapi.ErrorInsufficientFunds) {
+		t.Errorf("AddAdjustment() over balance error = %v, want %v", err, errorsapi.ErrorInsufficientFunds)
+	}
+	if _, err = src.AddAdjustment(ctx, userID, operatorID, 100, "BONUS", ""); !errors.Is(err, errorsapi.ErrorRegInfo) {
+		t.Errorf("AddAdjustment() unknown reason error = %v, want %v", err, errorsapi.ErrorRegInfo)
+	}
+	if _, err = src.AddAdjustment(ctx, userID, operatorID, 0, models.AdjustmentCorrection, ""); !errors.Is(err, errorsapi.ErrorRegInfo) {
+		t.Errorf("AddAdjustment() zero amount error = %v, want %v", err, errorsapi.ErrorRegInfo)
+	}
+	if _, err = src.AddAdjustment(ctx, operatorID+1000000, operatorID, 100, models.AdjustmentCorrection, ""); !errors.Is(err, errorsapi.ErrorUserNotFound) {
+		t.Errorf("AddAdjustment() unknown user error = %v, want %v", err, errorsapi.ErrorUserNotFound)
+	}
+	checkBalance(t, src, userID, 5550, 3000)
+
+	// изъятие мошеннически полученных баллов возможно и после того, как они потрачены
+	clawback, err := src.AddAdjustment(ctx, userID, operatorID, -6000, models.AdjustmentFraud, "points already spent")
+	if err != nil {
+		t.Fatalf("AddAdjustment() clawback error = %v", err)
+	}
+	checkBalance(t, src, userID, -450, 3000)
+	if err = src.AddWithdraw(ctx, userID, newOrder(), 100); !errors.Is(err, errorsapi.ErrorInsufficientFunds) {
+		t.Errorf("AddWithdraw() negative balance error = %v, want %v", err, errorsapi.ErrorInsufficientFunds)
+	}
+
+	history, err := src.GetHistory(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	want := []models.HistoryDB{
+		{Type: models.EntryAccrual, Reference: order, Amount: 10000},
+		{Type: models.EntryWithdrawal, Reference: withdrawal, Amount: -3000},
+		{Type: models.EntryAdjustment, Reference: strconv.FormatInt(credit, 10), Amount: 2550, Reason: models.AdjustmentGoodwill},
+		{Type: models.EntryAdjustment, Reference: strconv.FormatInt(debit, 10), Amount: -4000, Reason: models.AdjustmentFraud},
+		{Type: models.EntryAdjustment, Reference: strconv.FormatInt(clawback, 10), Amount: -6000, Reason: models.AdjustmentFraud},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("GetHistory() = %v, want %v", history, want)
+	}
+	for i := range want {
+		got := history[i]
+		if got.CreatedAt == "" {
+			t.Errorf("GetHistory()[%d] created at is empty", i)
+		}
+		got.CreatedAt = ""
+		if got != want[i] {
+			t.Errorf("GetHistory()[%d] = %v, want %v", i, got, want[i])
+		}
+	}
+
+	if history, err = src.GetHistory(ctx, operatorID); err != nil || len(history) != 0 {
+		t.Errorf("GetHistory() operator = %v, %v, want empty", history, err)
+	}
+}
+
+func testReversals(t *testing.T, src handlers.Sourcer) {
+	ctx := context.Background()
+	userID := newUser(t, src)
+	order, kept := newOrder(), newOrder()
+
+	if err := src.AddOrder(ctx, userID, newOrder(), "PROCESSED", 50000); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+	if err := src.AddWithdraw(ctx, userID, order, 20000); err != nil {
+		t.Fatalf("AddWithdraw() error = %v", err)
+	}
+	if err := src.AddWithdraw(ctx, userID, kept, 5000); err != nil {
+		t.Fatalf("AddWithdraw() error = %v", err)
+	}
+
+	withdraw, err := src.ReverseWithdraw(ctx, order, "shop", "order cancelled")
+	if err != nil || withdraw.Order != order || withdraw.Sum != 20000 || withdraw.ReversedAt == "" {
+		t.Fatalf("ReverseWithdraw() = %v, %v", withdraw, err)
+	}
+	// отменённое списание не учитывается в сумме списаний
+	checkBalance(t, src, userID, 45000, 5000)
+
+	// повторная отмена не возвращает баллы ещё раз
+	if withdraw, err = src.ReverseWithdraw(ctx, order, "shop", ""); !errors.Is(err, errorsapi.ErrorInfoFound) || withdraw.ReversedAt == "" {
+		t.Errorf("ReverseWithdraw() again = %v, %v, want %v", withdraw, err, errorsapi.ErrorInfoFound)
+	}
+	if _, err = src.ReverseWithdraw(ctx, newOrder(), "shop", ""); !errors.Is(err, errorsapi.ErrorWithdrawNotFound) {
+		t.Errorf("ReverseWithdraw() unknown order error = %v, want %v", err, errorsapi.ErrorWithdrawNotFound)
+	}
+	checkBalance(t, src, userID, 45000, 5000)
+
+	withdrawals, err := src.GetWithdrawals(ctx, userID)
+	if err != nil || len(withdrawals) != 2 {
+		t.Fatalf("GetWithdrawals() = %v, %v", withdrawals, err)
+	}
+	for _, w := range withdrawals {
+		if reversed := w.ReversedAt != ""; reversed != (w.Order == order) {
+			t.Errorf("GetWithdrawals() %s reversed at %q", w.Order, w.ReversedAt)
+		}
+	}
+
+	history, err := src.GetHistory(ctx, userID)
+	if err != nil || len(history) != 4 {
+		t.Fatalf("GetHistory() = %v, %v", history, err)
+	}
+	if last := history[3]; last.Type != models.EntryReversal || last.Reference != order || last.Amount != 20000 {
+		t.Errorf("GetHistory() reversal = %v", last)
+	}
+}
+
+func testHolds(t *testing.T, src holdSourcer) {
+	ctx := context.Background()
+	userID, otherID := newUser(t, src), newUser(t, src)
+	captured, released, expired, withdrawn := newOrder(), newOrder(), newOrder(), newOrder()
+	expiresAt := time.Now().Add(time.Hour)
+
+	if err := src.AddOrder(ctx, userID, newOrder(), "PROCESSED", 50000); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+	if err := src.AddWithdraw(ctx, userID, withdrawn, 5000); err != nil {
+		t.Fatalf("AddWithdraw() error = %v", err)
+	}
+
+	hold, err := src.CreateHold(ctx, userID, captured, 20000, expiresAt)
+	if err != nil || hold.Order != captured || hold.Sum != 20000 || hold.Status != models.HoldHeld || hold.ExpiresAt == "" {
+		t.Fatalf("CreateHold() = %v, %v", hold, err)
+	}
+	if _, err = src.CreateHold(ctx, userID, released, 10000, expiresAt); err != nil {
+		t.Fatalf("CreateHold() error = %v", err)
+	}
+	// зарезервированные баллы недоступны для списаний и новых резервов
+	checkBalance(t, src, userID, 15000, 5000)
+	checkHeld(t, src, userID, 30000)
+	if err = src.AddWithdraw(ctx, userID, newOrder(), 15001); !errors.Is(err, errorsapi.ErrorInsufficientFunds) {
+		t.Errorf("AddWithdraw() over available error = %v, want %v", err, errorsapi.ErrorInsufficientFunds)
+	}
+	if _, err = src.CreateHold(ctx, userID, newOrder(), 15001, expiresAt); !errors.Is(err, errorsapi.ErrorInsufficientFunds) {
+		t.Errorf("CreateHold() over available error = %v, want %v", err, errorsapi.ErrorInsufficientFunds)
+	}
+	if _, err = src.CreateHold(ctx, userID, newOrder()+"000000000", 100, expiresAt); !errors.Is(err, errorsapi.ErrorRegInfo) {
+		t.Errorf("CreateHold() long order error = %v, want %v", err, errorsapi.ErrorRegInfo)
+	}
+	if _, err = src.CreateHold(ctx, userID, captured, 100, expiresAt); !errors.Is(err, errorsapi.ErrorConflict) {
+		t.Errorf("CreateHold() same order error = %v, want %v", err, errorsapi.ErrorConflict)
+	}
+	if err = src.AddWithdraw(ctx, userID, captured, 100); !errors.Is(err, errorsapi.ErrorConflict) {
+		t.Errorf("AddWithdraw() held order error = %v, want %v", err, errorsapi.ErrorConflict)
+	}
+	if _, err = src.CreateHold(ctx, userID, withdrawn, 100, expiresAt); !errors.Is(err, errorsapi.ErrorConflict) {
+		t.Errorf("CreateHold() withdrawn order error = %v, want %v", err, errorsapi.ErrorConflict)
+	}
+
+	if _, err = src.CaptureHold(ctx, otherID, captured); !errors.Is(err, errorsapi.ErrorHoldNotFound) {
+		t.Errorf("CaptureHold() other user error = %v, want %v", err, errorsapi.ErrorHoldNotFound)
+	}
+	if hold, err = src.CaptureHold(ctx, userID, captured); err != nil || hold.Status != models.HoldCaptured {
+		t.Fatalf("CaptureHold() = %v, %v", hold, err)
+	}
+	if _, err = src.CaptureHold(ctx, 0, captured); !errors.Is(err, errorsapi.ErrorInfoFound) {
+		t.Errorf("CaptureHold() again error = %v, want %v", err, errorsapi.ErrorInfoFound)
+	}
+	if _, err = src.ReleaseHold(ctx, 0, captured); !errors.Is(err, errorsapi.ErrorHoldClosed) {
+		t.Errorf("ReleaseHold() captured error = %v, want %v", err, errorsapi.ErrorHoldClosed)
+	}
+	checkBalance(t, src, userID, 15000, 25000)
+	checkHeld(t, src, userID, 10000)
+
+	if hold, err = src.ReleaseHold(ctx, 0, released); err != nil || hold.Status != models.HoldReleased {
+		t.Fatalf("ReleaseHold() = %v, %v", hold, err)
+	}
+	if _, err = src.ReleaseHold(ctx, userID, released); !errors.Is(err, errorsapi.ErrorInfoFound) {
+		t.Errorf("ReleaseHold() again error = %v, want %v", err, errorsapi.ErrorInfoFound)
+	}
+	if _, err = src.CaptureHold(ctx, userID, released); !errors.Is(err, errorsapi.ErrorHoldClosed) {
+		t.Errorf("CaptureHold() released error = %v, want %v", err, errorsapi.ErrorHoldClosed)
+	}
+	if _, err = src.ReleaseHold(ctx, 0, newOrder()); !errors.Is(err, errorsapi.ErrorHoldNotFound) {
+		t.Errorf("ReleaseHold() unknown order error = %v, want %v", err, errorsapi.ErrorHoldNotFound)
+	}
+	checkBalance(t, src, userID, 25000, 25000)
+	checkHeld(t, src, userID, 0)
+
+	// истёкший резерв нельзя подтвердить, он снимается фоновым процессом
+	if _, err = src.CreateHold(ctx, userID, expired, 5000, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("CreateHold() error = %v", err)
+	}
+	if _, err = src.CaptureHold(ctx, userID, expired); !errors.Is(err, errorsapi.ErrorHoldClosed) {
+		t.Errorf("CaptureHold() expired error = %v, want %v", err, errorsapi.ErrorHoldClosed)
+	}
+	if count, err := src.ExpireHolds(ctx, 1000); err != nil || count < 1 {
+		t.Errorf("ExpireHolds() = %d, %v", count, err)
+	}
+	if hold, err = src.ReleaseHold(ctx, userID, expired); !errors.Is(err, errorsapi.ErrorInfoFound) || hold.Status != models.HoldExpired {
+		t.Errorf("ReleaseHold() expired = %v, %v, want %v", hold, err, errorsapi.ErrorInfoFound)
+	}
+	checkBalance(t, src, userID, 25000, 25000)
+	checkHeld(t, src, userID, 0)
+
+	withdrawals, err := src.GetWithdrawals(ctx, userID)
+	if err != nil || len(withdrawals) != 2 {
+		t.Errorf("GetWithdrawals() = %v, %v, want withdrawal and captured hold", withdrawals, err)
+	}
+}
+
+func testQueue(t *testing.T, src queueSourcer) {
+	ctx := context.Background()
+	userID := newUser(t, src)
+	pending, done := newOrder(), newOrder()
+
+	if err := src.AddOrder(ctx, userID, pending, "NEW", 0); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+	if err := src.AddOrder(ctx, userID, done, "INVALID", 0); err != nil {
+		t.Fatalf("AddOrder() error = %v", err)
+	}
+
+	lease := func() []string {
+		t.Helper()
+		orders, err := src.LeaseOrders(ctx, 10000, time.Minute)
+		if err != nil {
+			t.Fatalf("LeaseOrders() error = %v", err)
+		}
+		return orders
+	}
+
+	orders := lease()
+	if !slices.Contains(orders, pending) || slices.Contains(orders, done) {
+		t.Fatalf("LeaseOrders() = %v, want %s without final %s", orders, pending, done)
+	}
+	// захваченный заказ не выдаётся повторно до окончания аренды
+	if orders = lease(); slices.Contains(orders, pending) {
+		t.Errorf("LeaseOrders() leased order again")
+	}
+
+	if err := src.ReleaseOrders(ctx, 0, pending); err != nil {
+		t.Fatalf("ReleaseOrders() error = %v", err)
+	}
+	if orders = lease(); !slices.Contains(orders, pending) {
+		t.Errorf("LeaseOrders() released order is missing")
+	}
+
+	// после неудачной попытки заказ откладывается
+	if err := src.RetryOrder(ctx, pending); err != nil {
+		t.Fatalf("RetryOrder() error = %v", err)
+	}
+	if orders = lease(); slices.Contains(orders, pending) {
+		t.Errorf("LeaseOrders() retried order returned without backoff")
+	}
+
+	// начисление по окончательному статусу проводится один раз
+	for i := 0; i < 2; i++ {
+		if err := src.UpdateNotProcessedOrders(ctx, pending, "PROCESSED", 72998); err != nil {
+			t.Fatalf("UpdateNotProcessedOrders() error = %v", err)
+		}
+	}
+	// запоздавший ответ не изменяет окончательный статус
+	if err := src.UpdateNotProcessedOrders(ctx, pending, "PROCESSING", 0); err != nil {
+		t.Fatalf("UpdateNotProcessedOrders() late reply error = %v", err)
+	}
+	checkBalance(t, src, userID, 72998, 0)
+
+	list, _ := src.GetOrders(ctx, userID)
+	for _, o := range list {
+		if o.OrderNumber == pending && (o.Status != "PROCESSED" || o.Accrual != 72998) {
+			t.Errorf("GetOrders() order = %v, want PROCESSED 729.98", o)
+		}
+	}
+}
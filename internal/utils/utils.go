@@ -5,57 +5,8 @@ import (
 	"fmt"
 	"math/rand"
 	"strconv"
-	"time"
-
-	"github.com/golang-jwt/jwt/v4"
 )
 
-const TokenEXP = time.Hour * 3
-const SecretKEY = "*Hello-World*"
-
-// Структура описания JWT токена
-type Claims struct {
-	jwt.RegisteredClaims
-	UserID int
-}
-
-// Функция строитель строки JWT токена, с использованием ID пользователя
-func BuildJWTString(userID int) (string, error) {
-	// создаём новый токен с алгоритмом подписи HS256 и утверждениями — Claims
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			// когда создан токен
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenEXP)),
-		},
-		// собственное утверждение
-		UserID: userID,
-	})
-
-	// создаём строку токена
-	tokenString, err := token.SignedString([]byte(SecretKEY))
-	if err != nil {
-		return "", err
-	}
-
-	// возвращаем строку токена
-	return tokenString, nil
-}
-
-// Функция парсер JWT токена, для получения ID пользователя
-func GetUserID(tokenString string) int {
-	// создаём экземпляр структуры с утверждениями
-	claims := &Claims{}
-	// парсим из строки токена tokenString в структуру claims
-	// time.Sleep(time.Second * 4)
-	jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(SecretKEY), nil
-	})
-
-	// возвращаем ID пользователя в читаемом виде
-	return claims.UserID
-}
-
 // Функция проверки номера заказа на удовлетворения алгоритма Luhna
 func CheckOrderByLuna(orderNum string) bool {
 	sum := 0
@@ -0,0 +1,26 @@
+package models
+
+// Коды причин ручной корректировки баланса
+const (
+	// Компенсация пользователю от поддержки
+	AdjustmentGoodwill = "GOODWILL"
+	// Изъятие баллов, полученных мошенническим путём
+	AdjustmentFraud = "FRAUD"
+	// Исправление ошибки начисления или списания
+	AdjustmentCorrection = "CORRECTION"
+)
+
+// Функция проверки, что код причины корректировки известен
+func ValidAdjustmentReason(reason string) bool {
+	switch reason {
+	case AdjustmentGoodwill, AdjustmentFraud, AdjustmentCorrection:
+		return true
+	}
+	return false
+}
+
+// Функция проверки, что списание по коду причины может сделать остаток отрицательным:
+// изъятие мошеннически полученных баллов возможно и после того, как они потрачены
+func AdjustmentAllowsNegative(reason string) bool {
+	return reason == AdjustmentFraud
+}
@@ -0,0 +1,16 @@
+package models
+
+// Максимальная длина номера заказа, как у order_number в ya.orders и ya.withdrawals
+const MaxOrderNumberLen = 20
+
+// Состояния резерва баллов под списание
+const (
+	// Баллы зарезервированы и недоступны для других списаний
+	HoldHeld = "HELD"
+	// Резерв подтверждён и превращён в списание
+	HoldCaptured = "CAPTURED"
+	// Резерв отменён, баллы снова доступны
+	HoldReleased = "RELEASED"
+	// Резерв не подтверждён вовремя и снят фоновым процессом
+	HoldExpired = "EXPIRED"
+)
@@ -0,0 +1,13 @@
+package models
+
+// Типы проводок журнала ya.ledger
+const (
+	// Начисление баллов за обработанный заказ
+	EntryAccrual = "ACCRUAL"
+	// Списание баллов в счёт оплаты заказа
+	EntryWithdrawal = "WITHDRAWAL"
+	// Ручная корректировка баланса оператором
+	EntryAdjustment = "ADJUSTMENT"
+	// Возврат баллов по отменённому списанию
+	EntryReversal = "REVERSAL"
+)
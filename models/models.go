@@ -9,7 +9,7 @@ type (
 		// Статус
 		Status string
 		// Кол-во баллов
-		Accrual float32
+		Accrual Money
 		// Загружено
 		UploadAt string
 	}
@@ -20,30 +20,32 @@ type (
 		// Статус
 		Status string `json:"status"`
 		// Кол-во баллов
-		Accrual float32 `json:"accrual"`
+		Accrual Money `json:"accrual"`
 		// Загоужено
 		UploadAt string `json:"upload_at"`
 	}
 	// Структра баланса
 	WithdrawDB struct {
 		// Текущий
-		Current float32
+		Current Money
 		// Всего баллов
-		Withdrawn float32
+		Withdrawn Money
+		// Зарезервировано под списания
+		Held Money
 	}
 	//Структура запроса списания
 	WithdrawGet struct {
 		// Заказ
 		Order string `json:"order"`
 		// Сумма списания
-		Sum float32 `json:"sum"`
+		Sum Money `json:"sum"`
 	}
 	// Структура едиицы хранения списаний
 	Withdraw struct {
 		//Заказ
 		Order string `json:"order"`
 		// Сумма
-		Sum float32 `json:"sum"`
+		Sum Money `json:"sum"`
 		// Обработано
 		ProcessedAt string `json:"processed_at"`
 	}
@@ -51,9 +53,11 @@ type (
 		//Заказ
 		Order string
 		//Суммаа
-		Sum float32
+		Sum Money
 		//Обработано
 		ProcessedAt string
+		// Время отмены списания
+		ReversedAt string
 	}
 	// Запрос состояния
 	AccrualGet struct {
@@ -62,6 +66,47 @@ type (
 		// Статус
 		Status string `json:"status"`
 		// Сумма
-		Accrual float32 `json:"accrual"`
+		Accrual Money `json:"accrual"`
+	}
+	// Пользователь для администрирования
+	UserDB struct {
+		// ID пользователя
+		ID int
+		// Логин
+		Login string
+		// Роль
+		Role string
+		// Заблокирован
+		Blocked bool
+		// Причина блокировки
+		BlockedReason string
+		// Время блокировки
+		BlockedAt string
+	}
+	// Резерв баллов под списание
+	HoldDB struct {
+		// Заказ
+		Order string
+		// Сумма
+		Sum Money
+		// Состояние резерва
+		Status string
+		// Время резервирования
+		CreatedAt string
+		// Время, после которого неподтверждённый резерв снимается
+		ExpiresAt string
+	}
+	// Запись истории операций по счёту пользователя
+	HistoryDB struct {
+		// Тип операции: начисление, списание, корректировка
+		Type string
+		// Номер заказа или ID корректировки
+		Reference string
+		// Сумма, отрицательная для списаний
+		Amount Money
+		// Код причины корректировки
+		Reason string
+		// Время операции
+		CreatedAt string
 	}
 )
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Денежная сумма (баллы) с фиксированной точностью до сотых,
+// хранится в копейках, что соответствует numeric(10,2) в СУБД
+type Money int64
+
+// Количество копеек в рубле
+const moneyScale = 100
+
+// Функция разбора десятичной строки в Money без потери точности,
+// значения с большим количеством знаков, чем сотые, отклоняются
+func ParseMoney(s string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, fmt.Errorf("invalid money value %q", s)
+	}
+	r.Mul(r, big.NewRat(moneyScale, 1))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("money value %q has more than 2 decimal places", s)
+	}
+
+	num := r.Num()
+	if !num.IsInt64() {
+		return 0, fmt.Errorf("money value %q out of range", s)
+	}
+	return Money(num.Int64()), nil
+}
+
+// Строковое представление суммы без лишних нулей: 500, 729.98, 0.5
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	units, cents := v/moneyScale, v%moneyScale
+	if cents == 0 {
+		return sign + strconv.FormatInt(units, 10)
+	}
+	return strings.TrimRight(fmt.Sprintf("%s%d.%02d", sign, units, cents), "0")
+}
+
+// Сериализация в JSON числом, как и прежнее float представление
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// Десериализация из JSON числа или строки
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*m = 0
+		return nil
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Чтение значения из СУБД (numeric передаётся драйвером строкой)
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case string:
+		return m.scanString(v)
+	case []byte:
+		return m.scanString(string(v))
+	case int64:
+		*m = Money(v * moneyScale)
+	case float64:
+		return m.scanString(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Передача значения в СУБД десятичной строкой
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
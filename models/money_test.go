@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Money
+		wantErr bool
+	}{
+		{name: "integer", value: "500", want: 50000},
+		{name: "two decimals", value: "729.98", want: 72998},
+		{name: "one decimal", value: "0.1", want: 10},
+		{name: "numeric scale", value: "10.00", want: 1000},
+		{name: "negative", value: "-12.5", want: -1250},
+		{name: "trailing zeros", value: "1.0000", want: 100},
+		{name: "three decimals", value: "1.005", wantErr: true},
+		{name: "below cent", value: "0.004", wantErr: true},
+		{name: "negative below cent", value: "-0.005", wantErr: true},
+		{name: "exponent", value: "1e3", want: 100000},
+		{name: "invalid", value: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMoney() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney() = %v, want %v", int64(got), int64(tt.want))
+			}
+		})
+	}
+}
+
+func TestMoney_Scan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  any
+		want Money
+	}{
+		{name: "numeric string", src: "0.10", want: 10},
+		{name: "bytes", src: []byte("99999999.99"), want: 9999999999},
+		{name: "int64", src: int64(7), want: 700},
+		{name: "float64", src: 0.3, want: 30},
+		{name: "null", src: nil, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			if err := m.Scan(tt.src); err != nil {
+				t.Fatal(err)
+			}
+			if m != tt.want {
+				t.Errorf("Scan() = %v, want %v", int64(m), int64(tt.want))
+			}
+			// значение должно возвращаться в СУБД без изменений
+			v, _ := m.Value()
+			back, _ := ParseMoney(v.(string))
+			if back != m {
+				t.Errorf("Value() round trip = %v, want %v", v, m)
+			}
+		})
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	var w WithdrawGet
+	if err := json.Unmarshal([]byte(`{"order": "2377225624", "sum": 751.1}`), &w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Sum != 75110 {
+		t.Errorf("UnmarshalJSON() = %v, want 75110", int64(w.Sum))
+	}
+
+	out, _ := json.Marshal(WithdrawDB{Current: 50050, Withdrawn: 42, Held: 1000})
+	if string(out) != `{"Current":500.5,"Withdrawn":0.42,"Held":10}` {
+		t.Errorf("MarshalJSON() = %s", out)
+	}
+}
+
+func ExampleMoney_String() {
+	fmt.Println(Money(50000))
+	fmt.Println(Money(72998))
+	fmt.Println(Money(-50))
+
+	// Output:
+	// 500
+	// 729.98
+	// -0.5
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Параметры повторной обработки заказов очереди синхронизации с accrual системой
+const (
+	// Начальная задержка повторной попытки
+	RetryBaseDelay = time.Second * 10
+	// Максимальная задержка повторной попытки
+	RetryMaxDelay = time.Hour
+	// Количество учитываемых попыток, после которого заказ опрашивается с максимальной задержкой
+	RetryMaxAttempts = 20
+	// Интервал повторного опроса заказа, расчёт по которому ещё не окончен
+	PollInterval = time.Minute
+)
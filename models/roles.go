@@ -0,0 +1,20 @@
+package models
+
+// Роли пользователей
+const (
+	// Пользователь программы лояльности
+	RoleUser = "user"
+	// Сотрудник поддержки, просматривает заказы и баланс любого пользователя
+	RoleSupport = "support"
+	// Администратор, управляет пользователями
+	RoleAdmin = "admin"
+)
+
+// Функция проверки, что роль известна
+func ValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleSupport, RoleAdmin:
+		return true
+	}
+	return false
+}